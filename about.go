@@ -156,6 +156,7 @@ func About(statusEndpoints []StatusEndpoint, protocol, aboutFilePath, versionFil
 		LogsLinks:   aboutConfig.LogsLinks,
 		StatsLinks:  aboutConfig.StatsLinks,
 		CustomData:  aboutConfig.CustomData,
+		Maintenance: CurrentMaintenance().Mode,
 	}
 
 	// Execute status checks async
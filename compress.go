@@ -0,0 +1,207 @@
+package tyrgin
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// compressedETagMarker separates a strong ETag from the encoding Compress
+// added to it, unusual enough for no ETag of a handler to contain it.
+const compressedETagMarker = ";tyr-"
+
+// Defaults for any CompressConfig field left empty.
+var (
+	defaultCompressMinSize      = 1024
+	defaultCompressContentTypes = []string{
+		"application/json",
+		"application/javascript",
+		"application/xml",
+		"application/problem+json",
+		"image/svg+xml",
+		"text/",
+	}
+)
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header,
+// preferring gzip when both are equally acceptable. An empty string means the
+// response should not be compressed.
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := acceptQualities(acceptEncoding)
+
+	best, bestQuality := "", 0.0
+	for _, coding := range []string{"gzip", "deflate"} {
+		quality, ok := qualities[coding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = coding, quality
+		}
+	}
+
+	return best
+}
+
+// compressible reports whether a response with the given status and headers
+// may be compressed under config.
+func (w *compressWriter) compressible() bool {
+	status := w.Status()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	if w.Header().Get("Content-Encoding") != "" || w.buffer.Len() < w.config.MinSize {
+		return false
+	}
+
+	contentType := w.Header().Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(w.buffer.Bytes())
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	for _, allowed := range w.config.ContentTypes {
+		if strings.HasPrefix(contentType, allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decide settles whether the response is compressed and writes out what has
+// been held back so far.
+func (w *compressWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+
+	if w.compressible() {
+		w.Header().Set("Content-Encoding", w.encoding)
+		w.Header().Del("Content-Length")
+
+		// The compressed bytes differ from the ones a strong ETag promises,
+		// so the tag names the encoding. Conditional requests map it back.
+		if etag := w.Header().Get("ETag"); strings.HasPrefix(etag, `"`) && strings.HasSuffix(etag, `"`) {
+			w.Header().Set("ETag", strings.TrimSuffix(etag, `"`)+compressedETagMarker+w.encoding+`"`)
+		}
+
+		if w.encoding == "gzip" {
+			w.compressor, _ = gzip.NewWriterLevel(w.ResponseWriter, w.config.Level)
+		} else {
+			w.compressor, _ = zlib.NewWriterLevel(w.ResponseWriter, w.config.Level)
+		}
+	}
+
+	if w.buffer.Len() > 0 {
+		w.write(w.buffer.Bytes())
+		w.buffer.Reset()
+	}
+}
+
+// write sends data on to the client, through the compressor if there is one.
+func (w *compressWriter) write(data []byte) (int, error) {
+	if w.compressor != nil {
+		return w.compressor.Write(data)
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+// Write holds data back until MinSize bytes have been written.
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		return w.write(data)
+	}
+
+	w.buffer.Write(data)
+	if w.buffer.Len() >= w.config.MinSize {
+		w.decide()
+	}
+
+	return len(data), nil
+}
+
+// WriteString makes sure strings are held back like any other write.
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written also counts what is being held back.
+func (w *compressWriter) Written() bool {
+	return w.buffer.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// WriteHeaderNow settles the encoding before the headers go out.
+func (w *compressWriter) WriteHeaderNow() {
+	w.decide()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Flush sends whatever has been written so far to the client.
+func (w *compressWriter) Flush() {
+	w.decide()
+	if w.compressor != nil {
+		w.compressor.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// close finishes the response once the handlers are done.
+func (w *compressWriter) close() {
+	w.decide()
+	if w.compressor != nil {
+		w.compressor.Close()
+	}
+}
+
+// Compress returns a middleware compressing responses with gzip or deflate
+// as negotiated with the Accept-Encoding header. Install it ahead of Logger
+// so the logged response body is the uncompressed one. When it is installed
+// after Logger, for example on a route group, it slips in underneath the
+// Logger's writer for the same effect.
+func Compress(config CompressConfig) gin.HandlerFunc {
+	if config.Level == 0 {
+		config.Level = gzip.DefaultCompression
+	}
+	if config.MinSize == 0 {
+		config.MinSize = defaultCompressMinSize
+	}
+	if len(config.ContentTypes) == 0 {
+		config.ContentTypes = defaultCompressContentTypes
+	}
+
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead || c.GetHeader("Range") != "" {
+			c.Next()
+			return
+		}
+
+		if logged, ok := c.Writer.(*bufferedWriter); ok {
+			writer := &compressWriter{ResponseWriter: logged.ResponseWriter, config: config, encoding: encoding}
+			previous := logged.swap(writer)
+
+			c.Next()
+
+			logged.swap(previous)
+			writer.close()
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: c.Writer, config: config, encoding: encoding}
+		c.Writer = writer
+		defer func() {
+			c.Writer = writer.ResponseWriter
+		}()
+
+		c.Next()
+		writer.close()
+	}
+}
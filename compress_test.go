@@ -0,0 +1,82 @@
+package tyrgin
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+var largeMessage = strings.Repeat("tyr ", 1000)
+
+var compressActions = []APIAction{
+	NewRoute(func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": largeMessage})
+	}, "large", GET),
+	NewRoute(func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "tyr"})
+	}, "small", GET),
+	NewRoute(func(c *gin.Context) {
+		c.Data(http.StatusOK, "image/png", []byte(largeMessage))
+	}, "image", GET),
+}
+
+func TestCompressGzip(t *testing.T) {
+	for _, middleware := range [][]gin.HandlerFunc{
+		{Compress(CompressConfig{}), Logger()},
+		{Logger(), Compress(CompressConfig{})},
+	} {
+		hook := test.NewGlobal()
+		router := newTestRouter(compressActions, middleware...)
+
+		resp := performRequest(router, "GET", "/api/v1/tester/large", nil, "Accept-Encoding", "deflate;q=0.5, gzip")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "gzip", resp.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", resp.Header().Get("Vary"))
+
+		reader, err := gzip.NewReader(resp.Body)
+		assert.Nil(t, err)
+		body, err := ioutil.ReadAll(reader)
+		assert.Nil(t, err)
+		assert.Contains(t, string(body), largeMessage)
+
+		// The logger has to see the body before it was compressed.
+		responseBody := hook.LastEntry().Data["ResponseBody"].(map[string]interface{})
+		assert.Equal(t, largeMessage, responseBody["message"])
+	}
+}
+
+func TestCompressDeflate(t *testing.T) {
+	router := newTestRouter(compressActions, Compress(CompressConfig{}), Logger())
+
+	resp := performRequest(router, "GET", "/api/v1/tester/large", nil, "Accept-Encoding", "gzip;q=0, deflate")
+	assert.Equal(t, "deflate", resp.Header().Get("Content-Encoding"))
+
+	reader, err := zlib.NewReader(resp.Body)
+	assert.Nil(t, err)
+	body, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), largeMessage)
+}
+
+func TestCompressSkipped(t *testing.T) {
+	router := newTestRouter(compressActions, Compress(CompressConfig{}), Logger())
+
+	resp := performRequest(router, "GET", "/api/v1/tester/small", nil, "Accept-Encoding", "gzip")
+	assert.Equal(t, "", resp.Header().Get("Content-Encoding"))
+	assert.Equal(t, `{"message":"tyr"}`, resp.Body.String())
+
+	resp = performRequest(router, "GET", "/api/v1/tester/image", nil, "Accept-Encoding", "gzip")
+	assert.Equal(t, "", resp.Header().Get("Content-Encoding"))
+	assert.Equal(t, largeMessage, resp.Body.String())
+
+	resp = performRequest(router, "GET", "/api/v1/tester/large", nil, "Accept-Encoding", "identity")
+	assert.Equal(t, "", resp.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header().Get("Vary"))
+}
@@ -0,0 +1,201 @@
+package tyrgin
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Default values used for any CORSConfig field left empty.
+var (
+	defaultCORSMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	defaultCORSHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
+)
+
+// splitEnvList splits a comma separated environment variable into its
+// trimmed, non empty values.
+func splitEnvList(key string) []string {
+	values := []string{}
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// CORSConfigFromEnv builds a CORSConfig from the CORS_* environment variables.
+// The returned bool is false when neither CORS_ALLOW_ORIGINS nor
+// CORS_ALLOW_ORIGIN_PATTERNS is set, meaning CORS should stay disabled.
+func CORSConfigFromEnv() (CORSConfig, bool) {
+	config := CORSConfig{
+		AllowOrigins:        splitEnvList("CORS_ALLOW_ORIGINS"),
+		AllowOriginPatterns: splitEnvList("CORS_ALLOW_ORIGIN_PATTERNS"),
+		AllowMethods:        splitEnvList("CORS_ALLOW_METHODS"),
+		AllowHeaders:        splitEnvList("CORS_ALLOW_HEADERS"),
+		ExposeHeaders:       splitEnvList("CORS_EXPOSE_HEADERS"),
+	}
+
+	if credentials := os.Getenv("CORS_ALLOW_CREDENTIALS"); credentials != "" {
+		allow, err := strconv.ParseBool(credentials)
+		ErrorLogger(err, fmt.Sprintf("CORS_ALLOW_CREDENTIALS `%s` is not a boolean.", credentials))
+		config.AllowCredentials = allow
+	}
+
+	if maxAge := os.Getenv("CORS_MAX_AGE"); maxAge != "" {
+		seconds, err := strconv.Atoi(maxAge)
+		ErrorLogger(err, fmt.Sprintf("CORS_MAX_AGE `%s` is not a number of seconds.", maxAge))
+		config.MaxAge = time.Duration(seconds) * time.Second
+	}
+
+	enabled := len(config.AllowOrigins) > 0 || len(config.AllowOriginPatterns) > 0
+	return config, enabled
+}
+
+// wildcardOriginPattern turns an origin such as "https://*.stevens.edu" into
+// a regular expression where each * matches a single host label.
+func wildcardOriginPattern(origin string) string {
+	parts := strings.Split(origin, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+
+	return "^" + strings.Join(parts, "[^./]+") + "$"
+}
+
+// compile converts the config into a corsPolicy, logging and skipping any
+// origin pattern that is not a valid regular expression. Credentials are
+// never allowed together with any origin, that is logged and refused.
+func (config CORSConfig) compile() *corsPolicy {
+	methods := config.AllowMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+
+	headers := config.AllowHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+
+	policy := &corsPolicy{
+		origins:          make(map[string]bool),
+		allowMethods:     strings.ToUpper(strings.Join(methods, ", ")),
+		allowHeaders:     strings.Join(headers, ", "),
+		exposeHeaders:    strings.Join(config.ExposeHeaders, ", "),
+		allowCredentials: config.AllowCredentials,
+	}
+
+	if config.MaxAge > 0 {
+		policy.maxAge = strconv.Itoa(int(config.MaxAge / time.Second))
+	}
+
+	patterns := append([]string{}, config.AllowOriginPatterns...)
+	for _, origin := range config.AllowOrigins {
+		switch {
+		case origin == "*":
+			policy.allowAll = true
+		case strings.Contains(origin, "*"):
+			patterns = append(patterns, wildcardOriginPattern(origin))
+		default:
+			policy.origins[strings.ToLower(origin)] = true
+		}
+	}
+
+	if policy.allowAll && policy.allowCredentials {
+		ErrorLogger(ErrorCORSCredentialsForAnyOrigin, "CORS credentials are not allowed for origin `*`, list the origins instead.")
+		policy.allowCredentials = false
+	}
+
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			ErrorLogger(err, fmt.Sprintf("CORS origin pattern `%s` is invalid and was skipped.", pattern))
+			continue
+		}
+		policy.patterns = append(policy.patterns, re)
+	}
+
+	return policy
+}
+
+// allowed reports whether the given origin may access the service.
+func (p *corsPolicy) allowed(origin string) bool {
+	if p.allowAll || p.origins[strings.ToLower(origin)] {
+		return true
+	}
+
+	for _, re := range p.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CORS returns a middleware that adds the CORS headers described by config to
+// responses and answers preflight requests. It should be installed on the
+// router, ahead of any route group that requires a JWT, so that preflight
+// requests (which never carry credentials) are answered before authentication.
+func CORS(config CORSConfig) gin.HandlerFunc {
+	policy := config.compile()
+
+	return func(c *gin.Context) {
+		// Unless any origin is allowed the headers depend on the origin,
+		// even on responses to requests without one.
+		if !policy.allowAll {
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !policy.allowed(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if policy.allowAll {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if policy.allowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if policy.exposeHeaders != "" {
+				c.Header("Access-Control-Expose-Headers", policy.exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		c.Header("Access-Control-Allow-Methods", policy.allowMethods)
+		c.Header("Access-Control-Allow-Headers", policy.allowHeaders)
+		if policy.maxAge != "" {
+			c.Header("Access-Control-Max-Age", policy.maxAge)
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,85 @@
+package tyrgin
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var corsActions = []APIAction{
+	NewRoute(func(c *gin.Context) { c.Status(http.StatusOK) }, "hello", GET),
+}
+
+func TestCORSPreflight(t *testing.T) {
+	router := newTestRouter(corsActions, CORS(CORSConfig{
+		AllowOrigins: []string{"http://localhost:3000"},
+		MaxAge:       10 * time.Minute,
+	}))
+
+	preflight := []string{"Access-Control-Request-Method", "POST", "Access-Control-Request-Headers", "Content-Type"}
+	resp := performRequest(router, "OPTIONS", "/api/v1/tester/hello", nil, append(preflight, "Origin", "http://localhost:3000")...)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, "http://localhost:3000", resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST, PUT, PATCH, DELETE, OPTIONS", resp.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "600", resp.Header().Get("Access-Control-Max-Age"))
+
+	resp = performRequest(router, "OPTIONS", "/api/v1/tester/hello", nil, append(preflight, "Origin", "http://evil.com")...)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Equal(t, "", resp.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSSimpleRequest(t *testing.T) {
+	router := newTestRouter(corsActions, CORS(CORSConfig{
+		AllowOrigins:     []string{"https://*.stevens.edu"},
+		ExposeHeaders:    []string{"X-Request-ID"},
+		AllowCredentials: true,
+	}))
+
+	resp := performRequest(router, "GET", "/api/v1/tester/hello", nil, "Origin", "https://tyr.stevens.edu")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "https://tyr.stevens.edu", resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", resp.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "X-Request-ID", resp.Header().Get("Access-Control-Expose-Headers"))
+
+	resp = performRequest(router, "GET", "/api/v1/tester/hello", nil, "Origin", "https://a.b.stevens.edu")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "", resp.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSOriginPatterns(t *testing.T) {
+	policy := CORSConfig{
+		AllowOriginPatterns: []string{`^http://localhost:\d+$`, `(`},
+	}.compile()
+
+	assert.True(t, policy.allowed("http://localhost:8080"))
+	assert.False(t, policy.allowed("http://localhost"))
+	assert.Len(t, policy.patterns, 1)
+
+	// Patterns match the whole origin.
+	policy = CORSConfig{AllowOriginPatterns: []string{`https://.*\.stevens\.edu`}}.compile()
+	assert.True(t, policy.allowed("https://x.stevens.edu"))
+	assert.False(t, policy.allowed("https://x.stevens.edu.evil.com"))
+	assert.False(t, policy.allowed("http://evil.com/https://x.stevens.edu"))
+
+	policy = CORSConfig{AllowOrigins: []string{"*"}}.compile()
+	assert.True(t, policy.allowed("http://anything.com"))
+}
+
+func TestCORSAnyOriginWithoutCredentials(t *testing.T) {
+	router := newTestRouter(corsActions, CORS(CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true}))
+
+	resp := performRequest(router, "GET", "/api/v1/tester/hello", nil, "Origin", "http://evil.com")
+	assert.Equal(t, "*", resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "", resp.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestCORSVaryWithoutOrigin(t *testing.T) {
+	router := newTestRouter(corsActions, CORS(CORSConfig{AllowOrigins: []string{"https://tyr.stevens.edu"}}))
+
+	resp := performRequest(router, "GET", "/api/v1/tester/hello", nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "Origin", resp.Header().Get("Vary"))
+}
@@ -1,12 +1,11 @@
 package tyrgin
 
 import (
-	"fmt"
 	"log"
 	"os"
+	"path"
 
 	"github.com/appleboy/gin-jwt"
-	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
 	godotenv "github.com/joho/godotenv"
 )
@@ -14,6 +13,16 @@ import (
 // MongoTyrRSStatusEndpoint is for healthcheck api to know about mongo replica sets.
 var MongoTyrRSStatusEndpoint StatusEndpoint
 
+// PanicStatusEndpoint is for healthcheck api to know how many panics were recovered from.
+var PanicStatusEndpoint = StatusEndpoint{
+	Name:          "Recovered Panics",
+	Slug:          "panics",
+	Type:          "internal",
+	IsTraversable: false,
+	StatusCheck:   PanicStatusChecker{},
+	TraverseCheck: nil,
+}
+
 func init() {
 	env := os.Getenv("ENV")
 	if env == "" {
@@ -22,7 +31,11 @@ func init() {
 	}
 
 	if env == "dev" {
-		if err := godotenv.Load(); err != nil {
+		// Packages without a .env of their own, such as tests of sub packages,
+		// just use the environment.
+		if err := godotenv.Load(); os.IsNotExist(err) {
+			log.Println("No .env file, using the environment.")
+		} else if err != nil {
 			log.Fatal("Could not load .env file.")
 		}
 	}
@@ -44,24 +57,85 @@ func init() {
 	}
 }
 
+// handlers returns the middleware the APIAction asks for followed by its Func.
+func (a *APIAction) handlers(route *gin.RouterGroup) []gin.HandlerFunc {
+	handlers := []gin.HandlerFunc{}
+
+	if a.Redaction != nil {
+		handlers = append(handlers, Redact(a.Redaction))
+	}
+
+	if a.SkipBodyLogging {
+		handlers = append(handlers, SkipBodyLogging())
+	}
+
+	if a.RequireClientCert {
+		handlers = append(handlers, RequireClientCert())
+	}
+
+	if !a.IgnoreMaintenance {
+		handlers = append(handlers, MaintenanceGuard())
+	}
+
+	if a.Tenants != nil {
+		handlers = append(handlers, a.Tenants.Resolve())
+	}
+
+	if a.FeatureFlag != nil {
+		handlers = append(handlers, RequireFeatureFlag(a.FeatureFlag.Flags, a.FeatureFlag.Name))
+	}
+
+	if a.RateLimit != nil {
+		limit := *a.RateLimit
+		if limit.Name == "" {
+			limit.Name = string(a.Method) + " " + path.Join(route.BasePath(), a.Route)
+		}
+		handlers = append(handlers, RateLimiter(limit))
+	}
+
+	if a.MaxBodyBytes > 0 {
+		handlers = append(handlers, BodyLimit(a.MaxBodyBytes))
+	}
+
+	if a.Timeout > 0 {
+		handlers = append(handlers, Timeout(a.Timeout))
+	}
+
+	if a.IfMatch != nil {
+		handlers = append(handlers, IfMatch(a.IfMatch))
+	}
+
+	if a.ResponseSchema != nil {
+		handlers = append(handlers, ValidateResponse(a.ResponseSchema))
+	}
+
+	if a.RequestSchema != nil {
+		handlers = append(handlers, ValidateRequest(a.RequestSchema))
+	}
+
+	return append(handlers, a.Func)
+}
+
 // action takes the APIAction method and creates a gin route of that type.
 // Also makes the route private if it labeled as private in the apiaction.
 func (a *APIAction) action(route *gin.RouterGroup) {
+	handlers := a.handlers(route)
+
 	switch a.Method {
 	case GET:
-		route.GET(a.Route, a.Func)
+		route.GET(a.Route, handlers...)
 		break
 	case DELETE:
-		route.DELETE(a.Route, a.Func)
+		route.DELETE(a.Route, handlers...)
 		break
 	case PATCH:
-		route.PATCH(a.Route, a.Func)
+		route.PATCH(a.Route, handlers...)
 		break
 	case POST:
-		route.POST(a.Route, a.Func)
+		route.POST(a.Route, handlers...)
 		break
 	case PUT:
-		route.PUT(a.Route, a.Func)
+		route.PUT(a.Route, handlers...)
 		break
 	}
 }
@@ -86,25 +160,37 @@ func AddRoutes(router *gin.Engine, private bool, jwt *jwt.GinJWTMiddleware, vers
 
 }
 
-// NotFound a general 404 error message.
+// NotFound a general 404 handler, it falls back to the react app in ./static
+// when there is one and otherwise responds with a JSON 404.
 func NotFound(c *gin.Context) {
-	fmt.Println(c.Request.URL.Path[1:])
-	c.File("./static/index.html")
+	notFound(c)
 }
 
+var notFound = SPA(SPAConfig{})
+
 // SetupRouter returns an instance to a *gin.Enginer that is has
-// some preconfigurations already set up.
+// some preconfigurations already set up. Every request is given a request ID
+// that is logged with it, responses are compressed when the client accepts
+// it and panics are recovered from with a JSON 500. CORS is enabled when the CORS_* environment variables
+// configure any allowed origins.
 func SetupRouter() *gin.Engine {
-	router := gin.Default()
+	router := gin.New()
 
+	router.Use(RequestID())
+	router.Use(Compress(CompressConfig{}))
 	router.Use(Logger())
-	router.Use(gin.Recovery())
+	router.Use(Recovery())
+
+	if corsConfig, ok := CORSConfigFromEnv(); ok {
+		router.Use(CORS(corsConfig))
+	}
 
 	router.GET(
 		"/status/:slug",
 		HealthPointHandler(
 			[]StatusEndpoint{
 				MongoTyrRSStatusEndpoint,
+				PanicStatusEndpoint,
 			},
 			"./about.json",
 			"./version.txt",
@@ -115,13 +201,25 @@ func SetupRouter() *gin.Engine {
 	return router
 }
 
-// ServeReact is a function to serve react from a(n) service.
+// ServeReact is a function to serve react from a(n) service, from ./static.
+// Use ServeSPA to serve it from somewhere else.
 func ServeReact(r *gin.Engine) {
-	r.Use(static.Serve("/", static.LocalFile("./static", true)))
+	ServeSPA(r, SPAConfig{})
 }
 
 // ErrorHandler handles gin errors in a more clean way
 func ErrorHandler(err error, c *gin.Context, sc int, json interface{}) {
+	addVary(c.Writer.Header(), "Accept")
+
+	if format, negotiateErr := NegotiateFormat(c, errorFormats); negotiateErr == nil && format != FormatJSON {
+		if body, contentType, encodeErr := encodeFormat(format, json); encodeErr == nil {
+			c.Abort()
+			c.Data(sc, contentType, body)
+			c.Error(err)
+			return
+		}
+	}
+
 	c.Writer.Header().Add("Content-Type", "application/json+error")
 	c.AbortWithStatusJSON(sc, json)
 	c.Error(err)
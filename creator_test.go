@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/appleboy/gin-jwt"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
@@ -134,7 +135,25 @@ var testEndpoints = []APIAction{
 	testPut,
 }
 
-func performRequest(r http.Handler, method, path string, body []byte) *httptest.ResponseRecorder {
+// newTestRouter returns a router using the middleware, with the actions
+// under /api/v1/tester.
+func newTestRouter(actions []APIAction, middleware ...gin.HandlerFunc) *gin.Engine {
+	router := gin.New()
+	router.Use(middleware...)
+	AddRoutes(router, false, nil, "1", "tester", actions)
+
+	return router
+}
+
+// testClaims stands in for the JWT middleware, with the identity and role of
+// the claims taken from the X-User and X-Role headers.
+func testClaims(c *gin.Context) {
+	c.Set("JWT_PAYLOAD", jwt.MapClaims{"identity": c.GetHeader("X-User"), "role": c.GetHeader("X-Role")})
+}
+
+// performRequest sends a request to r and records the response. The headers
+// are name, value pairs, the ones with an empty value are not sent.
+func performRequest(r http.Handler, method, path string, body []byte, headers ...string) *httptest.ResponseRecorder {
 	var req *http.Request
 	if method == "GET" {
 		req, _ = http.NewRequest(method, path, nil)
@@ -145,6 +164,11 @@ func performRequest(r http.Handler, method, path string, body []byte) *httptest.
 		req.Header.Set("Accept", "application/json")
 		req.Header.Set("Content-Type", "application/json; charset=utf-8")
 	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		if headers[i+1] != "" {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+	}
 	resp := httptest.NewRecorder()
 	r.ServeHTTP(resp, req)
 	return resp
@@ -161,7 +185,10 @@ func TestNotFound(t *testing.T) {
 
 	resp := performRequest(router, "GET", "/", nil)
 	assert.Equal(t, http.StatusNotFound, resp.Code)
-	var response respTest
+	var response struct {
+		StatusCode int    `json:"statusCode"`
+		Message    string `json:"message"`
+	}
 	err := json.Unmarshal([]byte(resp.Body.String()), &response)
 	assert.Nil(t, err)
 	assert.Equal(t, body["statusCode"], response.StatusCode)
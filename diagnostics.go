@@ -0,0 +1,227 @@
+package tyrgin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	runtimepprof "runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Debug logging can be raised for a request ID or user for at most an hour,
+// for 10 minutes unless asked otherwise.
+const (
+	defaultVerboseDuration = 10 * time.Minute
+	maxVerboseDuration     = time.Hour
+)
+
+var (
+	verboseMu          sync.RWMutex
+	verboseTargets     = []VerboseLogging{}
+	verboseIdentityKey = jwt.IdentityKey
+)
+
+// activeVerboseTargetsLocked returns the targets that have not expired yet,
+// the caller holds the lock.
+func activeVerboseTargetsLocked() []VerboseLogging {
+	now := time.Now()
+	active := []VerboseLogging{}
+	for _, target := range verboseTargets {
+		if now.Before(target.Until) {
+			active = append(active, target)
+		}
+	}
+
+	return active
+}
+
+// activeVerboseTargets returns the targets that have not expired yet.
+func activeVerboseTargets() []VerboseLogging {
+	verboseMu.RLock()
+	defer verboseMu.RUnlock()
+
+	return activeVerboseTargetsLocked()
+}
+
+// verboseRequest reports whether debug logging was raised for the request
+// handled by c or for the user making it.
+func verboseRequest(c *gin.Context) bool {
+	verboseMu.RLock()
+	defer verboseMu.RUnlock()
+
+	if len(verboseTargets) == 0 {
+		return false
+	}
+
+	requestID := GetRequestID(c)
+	var user string
+	if identity, ok := jwt.ExtractClaims(c)[verboseIdentityKey]; ok && identity != nil {
+		user = fmt.Sprintf("%v", identity)
+	}
+
+	now := time.Now()
+	for _, target := range verboseTargets {
+		if now.After(target.Until) {
+			continue
+		}
+		if (target.RequestID != "" && target.RequestID == requestID) || (target.User != "" && target.User == user) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verboseLogger returns a logger writing to the sinks of the standard one
+// but at debug level. Only sinks at debug or trace level, as they are by
+// default, take the debug entries, a sink for errors stays quiet.
+func verboseLogger() *log.Logger {
+	std := log.StandardLogger()
+	return &log.Logger{
+		Out:          std.Out,
+		Hooks:        copiedHooks(std.Hooks),
+		Formatter:    std.Formatter,
+		ReportCaller: std.ReportCaller,
+		Level:        log.DebugLevel,
+		ExitFunc:     std.ExitFunc,
+	}
+}
+
+// DiagnosticsRoutes returns APIActions to read and change the log level,
+// raise it to debug for a single request ID or user, dump the goroutines and
+// profile the service with net/http/pprof. Add them with AddRoutes as private
+// routes, only admins, by default users with the admin role, may use them.
+// They keep working during maintenance.
+func DiagnosticsRoutes(config DiagnosticsConfig) []APIAction {
+	if config.IdentityKey == "" {
+		config.IdentityKey = jwt.IdentityKey
+	}
+	if config.Admin == nil {
+		config.Admin = adminRole(FlagSubjectFromJWT(config.IdentityKey))
+	}
+
+	verboseMu.Lock()
+	verboseIdentityKey = config.IdentityKey
+	verboseMu.Unlock()
+
+	route := func(fn func(c *gin.Context), endpoint string, method httpMethod) APIAction {
+		action := NewRoute(func(c *gin.Context) {
+			if !config.Admin(c) {
+				resourceError(c, ErrorForbidden, http.StatusForbidden)
+				return
+			}
+			fn(c)
+		}, endpoint, method)
+		action.IgnoreMaintenance = true
+
+		return action
+	}
+
+	level := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"level":   log.GetLevel().String(),
+			"verbose": activeVerboseTargets(),
+		})
+	}
+
+	setLevel := func(c *gin.Context) {
+		var body struct {
+			Level string `json:"level" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			resourceError(c, err, http.StatusBadRequest)
+			return
+		}
+
+		parsed, err := log.ParseLevel(body.Level)
+		if err != nil {
+			resourceError(c, ErrorInvalidLogLevel, http.StatusBadRequest)
+			return
+		}
+		log.SetLevel(parsed)
+		ContextNormalLog(c, "Log level is now "+parsed.String()+".")
+
+		level(c)
+	}
+
+	verbose := func(c *gin.Context) {
+		var target VerboseLogging
+		if err := c.ShouldBindJSON(&target); err != nil {
+			resourceError(c, err, http.StatusBadRequest)
+			return
+		}
+
+		duration := defaultVerboseDuration
+		if target.Duration != "" {
+			var err error
+			duration, err = time.ParseDuration(target.Duration)
+			if err != nil || duration <= 0 || duration > maxVerboseDuration {
+				resourceError(c, ErrorInvalidVerboseLogging, http.StatusBadRequest)
+				return
+			}
+		}
+		if (target.RequestID == "") == (target.User == "") {
+			resourceError(c, ErrorInvalidVerboseLogging, http.StatusBadRequest)
+			return
+		}
+		target.Duration = duration.String()
+		target.Until = time.Now().Add(duration).UTC()
+
+		verboseMu.Lock()
+		verboseTargets = append(activeVerboseTargetsLocked(), target)
+		verboseMu.Unlock()
+		ContextNormalLog(c, fmt.Sprintf("Debug logging raised for %+v.", target))
+
+		c.JSON(http.StatusCreated, target)
+	}
+
+	quiet := func(c *gin.Context) {
+		verboseMu.Lock()
+		verboseTargets = []VerboseLogging{}
+		verboseMu.Unlock()
+
+		c.Status(http.StatusNoContent)
+	}
+
+	goroutines := func(c *gin.Context) {
+		StopResponseCapture(c)
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.Status(http.StatusOK)
+		runtimepprof.Lookup("goroutine").WriteTo(c.Writer, 2)
+	}
+
+	profile := func(c *gin.Context) {
+		StopResponseCapture(c)
+
+		switch name := strings.TrimPrefix(c.Param("profile"), "/"); name {
+		case "":
+			pprof.Index(c.Writer, c.Request)
+		case "cmdline":
+			pprof.Cmdline(c.Writer, c.Request)
+		case "profile":
+			pprof.Profile(c.Writer, c.Request)
+		case "symbol":
+			pprof.Symbol(c.Writer, c.Request)
+		case "trace":
+			pprof.Trace(c.Writer, c.Request)
+		default:
+			pprof.Handler(name).ServeHTTP(c.Writer, c.Request)
+		}
+	}
+
+	return []APIAction{
+		route(level, "loglevel", GET),
+		route(setLevel, "loglevel", PUT),
+		route(verbose, "loglevel/verbose", POST),
+		route(quiet, "loglevel/verbose", DELETE),
+		route(goroutines, "goroutines", GET),
+		route(profile, "pprof/*profile", GET),
+		route(profile, "pprof/*profile", POST),
+	}
+}
@@ -0,0 +1,112 @@
+package tyrgin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func diagnosticsActions() []APIAction {
+	return append(DiagnosticsRoutes(DiagnosticsConfig{}), NewRoute(func(c *gin.Context) {
+		ContextLogger(c).Debug("Working")
+		c.Status(http.StatusOK)
+	}, "work", GET))
+}
+
+func TestDiagnosticsLogLevel(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+
+	router := newTestRouter(diagnosticsActions(), RequestID(), testClaims)
+	admin := []string{"X-Role", "admin"}
+
+	w := performRequest(router, "GET", "/api/v1/tester/loglevel", nil, "X-Role", "student")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performRequest(router, "PUT", "/api/v1/tester/loglevel", []byte(`{"level": "loud"}`), admin...)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performRequest(router, "PUT", "/api/v1/tester/loglevel", []byte(`{"level": "warn"}`), admin...)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, log.WarnLevel, log.GetLevel())
+
+	var resp map[string]interface{}
+	w = performRequest(router, "GET", "/api/v1/tester/loglevel", nil, admin...)
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "warning", resp["level"])
+}
+
+func TestDiagnosticsVerbose(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	hooks := log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+	defer log.StandardLogger().ReplaceHooks(hooks)
+	hook := test.NewGlobal()
+
+	log.SetLevel(log.InfoLevel)
+	router := newTestRouter(diagnosticsActions(), RequestID(), testClaims)
+	admin := []string{"X-Role", "admin"}
+
+	w := performRequest(router, "POST", "/api/v1/tester/loglevel/verbose", []byte(`{"requestId": "a", "user": "b"}`), admin...)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "POST", "/api/v1/tester/loglevel/verbose", []byte(`{"user": "b", "duration": "2h"}`), admin...)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performRequest(router, "POST", "/api/v1/tester/loglevel/verbose", []byte(`{"requestId": "trace-me"}`), admin...)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = performRequest(router, "POST", "/api/v1/tester/loglevel/verbose", []byte(`{"user": "jdoe", "duration": "1m"}`), admin...)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	debugEntries := func() int {
+		count := 0
+		for _, entry := range hook.AllEntries() {
+			if entry.Level == log.DebugLevel && entry.Message == "Working" {
+				count++
+			}
+		}
+		return count
+	}
+
+	performRequest(router, "GET", "/api/v1/tester/work", nil)
+	assert.Equal(t, 0, debugEntries())
+	performRequest(router, "GET", "/api/v1/tester/work", nil, RequestIDHeader, "trace-me")
+	assert.Equal(t, 1, debugEntries())
+	performRequest(router, "GET", "/api/v1/tester/work", nil, "X-User", "jdoe")
+	assert.Equal(t, 2, debugEntries())
+
+	var resp struct {
+		Verbose []VerboseLogging `json:"verbose"`
+	}
+	w = performRequest(router, "GET", "/api/v1/tester/loglevel", nil, admin...)
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Verbose, 2)
+
+	w = performRequest(router, "DELETE", "/api/v1/tester/loglevel/verbose", nil, admin...)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	performRequest(router, "GET", "/api/v1/tester/work", nil, "X-User", "jdoe")
+	assert.Equal(t, 2, debugEntries())
+}
+
+func TestDiagnosticsProfiles(t *testing.T) {
+	router := newTestRouter(diagnosticsActions(), RequestID(), testClaims)
+	admin := []string{"X-Role", "admin"}
+
+	w := performRequest(router, "GET", "/api/v1/tester/goroutines", nil, admin...)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "goroutine "))
+
+	w = performRequest(router, "GET", "/api/v1/tester/pprof/", nil, admin...)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "heap"))
+
+	w = performRequest(router, "GET", "/api/v1/tester/pprof/heap?debug=1", nil, admin...)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "heap profile"))
+
+	w = performRequest(router, "GET", "/api/v1/tester/pprof/heap", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,205 @@
+package tyrgin
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ComputeETag returns a quoted ETag for data, prefixed with W/ when weak.
+func ComputeETag(data []byte, weak bool) string {
+	sum := sha256.Sum256(data)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:18]) + `"`
+	if weak {
+		return "W/" + etag
+	}
+
+	return etag
+}
+
+// SetETag lets a handler supply the ETag of its response, which the ETag
+// middleware then uses instead of hashing the body.
+func SetETag(c *gin.Context, etag string) {
+	c.Header("ETag", etag)
+}
+
+// etagsMatch compares two ETags, ignoring whether they are weak unless strong is set.
+func etagsMatch(a, b string, strong bool) bool {
+	if strong {
+		return !strings.HasPrefix(a, "W/") && a == b
+	}
+
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// uncompressedETag returns the ETag a strong ETag had before Compress named
+// its encoding in it.
+func uncompressedETag(etag string) string {
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if suffix := compressedETagMarker + encoding + `"`; strings.HasSuffix(etag, suffix) && !strings.HasPrefix(etag, "W/") {
+			return strings.TrimSuffix(etag, suffix) + `"`
+		}
+	}
+
+	return etag
+}
+
+// etagListMatches reports whether etag is in a If-Match or If-None-Match
+// header, which may hold ETags of compressed responses.
+func etagListMatches(header, etag string, strong bool) bool {
+	if etag == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = uncompressedETag(strings.TrimSpace(candidate))
+		if candidate == "*" || etagsMatch(candidate, etag, strong) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModified reports whether the conditional headers of req mean a response
+// with the given headers does not need to be sent again. If-Modified-Since
+// is only considered when there is no If-None-Match.
+func notModified(req *http.Request, header http.Header) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagListMatches(ifNoneMatch, header.Get("ETag"), false)
+	}
+
+	ifModifiedSince, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+
+	return !lastModified.Truncate(time.Second).After(ifModifiedSince)
+}
+
+// Write holds data back until the handler is done, unless the response is
+// being streamed.
+func (w *etagWriter) Write(data []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+
+	return w.body.Write(data)
+}
+
+// WriteString makes sure strings are held back like any other write.
+func (w *etagWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written also counts what is being held back.
+func (w *etagWriter) Written() bool {
+	return w.body.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// WriteHeaderNow is put off until the ETag is known.
+func (w *etagWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Flush means the response is streamed, so it is sent as is without an ETag.
+func (w *etagWriter) Flush() {
+	if !w.passthrough {
+		w.passthrough = true
+		w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// ETag returns a middleware adding ETags to successful GET and HEAD responses
+// that lack one, and answering If-None-Match and If-Modified-Since requests
+// with a 304 when the client already has the response.
+func ETag(config ETagConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		writer := &etagWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() {
+			c.Writer = writer.ResponseWriter
+		}()
+
+		c.Next()
+
+		if writer.passthrough {
+			return
+		}
+
+		header := writer.Header()
+		if writer.Status() == http.StatusOK {
+			if header.Get("ETag") == "" && writer.body.Len() > 0 {
+				header.Set("ETag", ComputeETag(writer.body.Bytes(), config.Weak))
+			}
+
+			if notModified(c.Request, header) {
+				header.Del("Content-Type")
+				header.Del("Content-Length")
+				writer.ResponseWriter.WriteHeader(http.StatusNotModified)
+				writer.ResponseWriter.WriteHeaderNow()
+				return
+			}
+		}
+
+		if writer.body.Len() > 0 {
+			writer.ResponseWriter.Write(writer.body.Bytes())
+		}
+	}
+}
+
+// CheckIfMatch evaluates the If-Match header of the request against the
+// current ETag of the resource, an empty string meaning it does not exist.
+// When the precondition fails a 412 is sent and false returned, so handlers
+// can use it directly for optimistic concurrency.
+func CheckIfMatch(c *gin.Context, currentETag string) bool {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" || etagListMatches(ifMatch, currentETag, true) {
+		return true
+	}
+
+	ErrorHandler(ErrorPreconditionFailed, c, http.StatusPreconditionFailed, gin.H{
+		"statusCode": http.StatusPreconditionFailed,
+		"message":    ErrorPreconditionFailed.Error(),
+	})
+	return false
+}
+
+// IfMatch returns a middleware enforcing If-Match preconditions against the
+// ETag returned by current. It is added to an APIAction through its IfMatch
+// field.
+func IfMatch(current ETagFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("If-Match") == "" {
+			c.Next()
+			return
+		}
+
+		etag, err := current(c)
+		if err != nil {
+			resourceError(c, err, http.StatusInternalServerError)
+			return
+		}
+
+		if CheckIfMatch(c, etag) {
+			c.Next()
+		}
+	}
+}
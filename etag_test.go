@@ -0,0 +1,102 @@
+package tyrgin
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var etagLastModified = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func etagActions() []APIAction {
+	update := NewRoute(func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	}, "assignment", PUT)
+	update.IfMatch = func(c *gin.Context) (string, error) {
+		return `"v2"`, nil
+	}
+
+	return []APIAction{
+		NewRoute(func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"name": "hw1"})
+		}, "assignment", GET),
+		NewRoute(func(c *gin.Context) {
+			c.Header("Last-Modified", etagLastModified.Format(http.TimeFormat))
+			c.String(http.StatusOK, "modified")
+		}, "modified", GET),
+		update,
+	}
+}
+
+func TestETagIfNoneMatch(t *testing.T) {
+	router := newTestRouter(etagActions(), ETag(ETagConfig{}))
+
+	resp := performRequest(router, "GET", "/api/v1/tester/assignment", nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	etag := resp.Header().Get("ETag")
+	assert.Equal(t, ComputeETag([]byte(`{"name":"hw1"}`), false), etag)
+	assert.Equal(t, `{"name":"hw1"}`, resp.Body.String())
+
+	resp = performRequest(router, "GET", "/api/v1/tester/assignment", nil, "If-None-Match", `"other", W/`+etag)
+	assert.Equal(t, http.StatusNotModified, resp.Code)
+	assert.Equal(t, etag, resp.Header().Get("ETag"))
+	assert.Equal(t, "", resp.Body.String())
+
+	resp = performRequest(router, "GET", "/api/v1/tester/assignment", nil, "If-None-Match", `"other"`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestETagIfModifiedSince(t *testing.T) {
+	router := newTestRouter(etagActions(), ETag(ETagConfig{}))
+
+	resp := performRequest(router, "GET", "/api/v1/tester/modified", nil, "If-Modified-Since", etagLastModified.Format(http.TimeFormat))
+	assert.Equal(t, http.StatusNotModified, resp.Code)
+
+	resp = performRequest(router, "GET", "/api/v1/tester/modified", nil, "If-Modified-Since", etagLastModified.Add(-time.Hour).Format(http.TimeFormat))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "modified", resp.Body.String())
+}
+
+func TestIfMatch(t *testing.T) {
+	router := newTestRouter(etagActions(), ETag(ETagConfig{}))
+
+	resp := performRequest(router, "PUT", "/api/v1/tester/assignment", nil, "If-Match", `"v2"`)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	resp = performRequest(router, "PUT", "/api/v1/tester/assignment", nil, "If-Match", `"v1"`)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+
+	resp = performRequest(router, "PUT", "/api/v1/tester/assignment", nil, "If-Match", `W/"v2"`)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+
+	resp = performRequest(router, "PUT", "/api/v1/tester/assignment", nil)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+}
+
+func TestIfMatchBehindCompress(t *testing.T) {
+	assignment := NewRoute(func(c *gin.Context) {
+		SetETag(c, `"v2"`)
+		c.String(http.StatusOK, "assignment")
+	}, "assignment", GET)
+	update := NewRoute(func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	}, "assignment", PUT)
+	update.IfMatch = func(c *gin.Context) (string, error) {
+		return `"v2"`, nil
+	}
+	router := newTestRouter([]APIAction{assignment, update}, Compress(CompressConfig{MinSize: 1}))
+
+	resp := performRequest(router, "GET", "/api/v1/tester/assignment", nil, "Accept-Encoding", "gzip")
+	assert.Equal(t, "gzip", resp.Header().Get("Content-Encoding"))
+	etag := resp.Header().Get("ETag")
+	assert.Equal(t, `"v2;tyr-gzip"`, etag)
+
+	resp = performRequest(router, "PUT", "/api/v1/tester/assignment", nil, "If-Match", etag)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	// A handler ETag that only looks like an encoding is kept as it is.
+	assert.Equal(t, `"v2-gzip"`, uncompressedETag(`"v2-gzip"`))
+}
@@ -0,0 +1,385 @@
+package tyrgin
+
+import (
+	ctx "context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
+)
+
+const defaultFeatureFlagRefresh = 30 * time.Second
+
+// NewMemoryFeatureFlagStore returns an empty MemoryFeatureFlagStore.
+func NewMemoryFeatureFlagStore() *MemoryFeatureFlagStore {
+	return &MemoryFeatureFlagStore{flags: map[string]FeatureFlag{}}
+}
+
+// All implements FeatureFlagStore.
+func (m *MemoryFeatureFlagStore) All() ([]FeatureFlag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	flags := make([]FeatureFlag, 0, len(m.flags))
+	for _, flag := range m.flags {
+		flags = append(flags, flag)
+	}
+
+	return flags, nil
+}
+
+// Save implements FeatureFlagStore.
+func (m *MemoryFeatureFlagStore) Save(flag FeatureFlag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.flags[flag.Name] = flag
+	return nil
+}
+
+// Delete implements FeatureFlagStore.
+func (m *MemoryFeatureFlagStore) Delete(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.flags[name]; !ok {
+		return ErrorFeatureFlagNotFound
+	}
+	delete(m.flags, name)
+
+	return nil
+}
+
+// NewMongoFeatureFlagStore returns a FeatureFlagStore keeping the flags in
+// the given collection, one document per flag with its name as the _id.
+func NewMongoFeatureFlagStore(db *mongo.Database, collection string) *MongoFeatureFlagStore {
+	return &MongoFeatureFlagStore{Collection: GetMongoCollection(collection, db)}
+}
+
+// All implements FeatureFlagStore.
+func (m *MongoFeatureFlagStore) All() ([]FeatureFlag, error) {
+	cursor, err := m.Collection.Find(ctx.Background(), bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx.Background())
+
+	flags := []FeatureFlag{}
+	for cursor.Next(ctx.Background()) {
+		var flag FeatureFlag
+		if err := cursor.Decode(&flag); err != nil {
+			return nil, err
+		}
+		flags = append(flags, flag)
+	}
+
+	return flags, cursor.Err()
+}
+
+// Save implements FeatureFlagStore.
+func (m *MongoFeatureFlagStore) Save(flag FeatureFlag) error {
+	_, err := m.Collection.ReplaceOne(
+		ctx.Background(),
+		bson.D{{Key: "_id", Value: flag.Name}},
+		flag,
+		options.Replace().SetUpsert(true),
+	)
+
+	return err
+}
+
+// Delete implements FeatureFlagStore.
+func (m *MongoFeatureFlagStore) Delete(name string) error {
+	result, err := m.Collection.DeleteOne(ctx.Background(), bson.D{{Key: "_id", Value: name}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrorFeatureFlagNotFound
+	}
+
+	return nil
+}
+
+// FlagSubjectFromJWT returns a FlagSubjectFunc reading the user from the
+// identity gin-jwt stored under identityKey and the roles from a roles claim
+// holding a list, or a role claim holding one.
+func FlagSubjectFromJWT(identityKey string) FlagSubjectFunc {
+	return func(c *gin.Context) FlagSubject {
+		claims := jwt.ExtractClaims(c)
+		subject := FlagSubject{}
+
+		identity, ok := c.Get(identityKey)
+		if !ok {
+			identity, ok = claims[identityKey]
+		}
+		if ok && identity != nil {
+			subject.User = fmt.Sprintf("%v", identity)
+		}
+
+		if roles, ok := claims["roles"].([]interface{}); ok {
+			for _, role := range roles {
+				subject.Roles = append(subject.Roles, fmt.Sprintf("%v", role))
+			}
+		}
+		if role, ok := claims["role"].(string); ok {
+			subject.Roles = append(subject.Roles, role)
+		}
+
+		return subject
+	}
+}
+
+// adminRole returns a check passing requests whose subject has the admin
+// role, the default for the admin routes of the package.
+func adminRole(subject FlagSubjectFunc) func(c *gin.Context) bool {
+	return func(c *gin.Context) bool {
+		for _, role := range subject(c).Roles {
+			if role == "admin" {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// rolloutBucket places a user in one of 100 buckets for a flag, so a user
+// stays in or out of a rollout as its percentage grows.
+func rolloutBucket(flag, user string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(flag + ":" + user))
+	return int(hash.Sum32() % 100)
+}
+
+// Evaluate reports whether the flag is on for subject. A disabled flag is off
+// for everyone. Otherwise it is on for the Users and Roles it targets and,
+// when Rollout is set, for that percentage of the other users. A flag that
+// targets no one and has no Rollout is on for everyone.
+func (f FeatureFlag) Evaluate(subject FlagSubject) bool {
+	if !f.Enabled {
+		return false
+	}
+
+	for _, user := range f.Users {
+		if subject.User != "" && user == subject.User {
+			return true
+		}
+	}
+	for _, role := range f.Roles {
+		for _, subjectRole := range subject.Roles {
+			if role == subjectRole {
+				return true
+			}
+		}
+	}
+
+	if f.Rollout != nil {
+		return subject.User != "" && rolloutBucket(f.Name, subject.User) < *f.Rollout
+	}
+
+	return len(f.Users) == 0 && len(f.Roles) == 0
+}
+
+// NewFeatureFlags returns the feature flags kept in config.Store, loading
+// them right away.
+func NewFeatureFlags(config FeatureFlagConfig) (*FeatureFlags, error) {
+	if config.Store == nil {
+		config.Store = NewMemoryFeatureFlagStore()
+	}
+	if config.Refresh == 0 {
+		config.Refresh = defaultFeatureFlagRefresh
+	}
+	if config.Subject == nil {
+		config.Subject = FlagSubjectFromJWT(jwt.IdentityKey)
+	}
+	if config.Admin == nil {
+		config.Admin = adminRole(config.Subject)
+	}
+
+	f := &FeatureFlags{config: config}
+	if err := f.Refresh(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Refresh reloads the flags from the store.
+func (f *FeatureFlags) Refresh() error {
+	flags, err := f.config.Store.All()
+	if err != nil {
+		return err
+	}
+
+	cache := make(map[string]FeatureFlag, len(flags))
+	for _, flag := range flags {
+		cache[flag.Name] = flag
+	}
+
+	f.mu.Lock()
+	f.flags = cache
+	f.loaded = time.Now()
+	f.mu.Unlock()
+
+	return nil
+}
+
+// cached returns the flags, refreshing them first when they are older than
+// the Refresh of the config. Only one caller refreshes at a time, the others
+// keep using the flags they have, as does everyone if the refresh fails until
+// it is tried again a Refresh later.
+func (f *FeatureFlags) cached() map[string]FeatureFlag {
+	f.mu.RLock()
+	flags, stale := f.flags, time.Since(f.loaded) > f.config.Refresh
+	f.mu.RUnlock()
+
+	if stale && atomic.CompareAndSwapInt32(&f.refreshing, 0, 1) {
+		defer atomic.StoreInt32(&f.refreshing, 0)
+		if err := f.Refresh(); err != nil {
+			f.mu.Lock()
+			f.loaded = time.Now()
+			f.mu.Unlock()
+
+			ErrorLogger(err, "Could not refresh feature flags.")
+			return flags
+		}
+
+		f.mu.RLock()
+		flags = f.flags
+		f.mu.RUnlock()
+	}
+
+	return flags
+}
+
+// Lookup returns the flag with the given name.
+func (f *FeatureFlags) Lookup(name string) (FeatureFlag, bool) {
+	flag, ok := f.cached()[name]
+	return flag, ok
+}
+
+// Enabled reports whether the flag with the given name is on for the request
+// handled by c. Unknown flags are off.
+func (f *FeatureFlags) Enabled(c *gin.Context, name string) bool {
+	flag, ok := f.Lookup(name)
+	return ok && flag.Evaluate(f.config.Subject(c))
+}
+
+// Gate returns a gate for an APIAction's FeatureFlag field.
+func (f *FeatureFlags) Gate(name string) *FeatureFlagGate {
+	return &FeatureFlagGate{Flags: f, Name: name}
+}
+
+// RequireFeatureFlag returns a middleware answering with a 404 unless the
+// flag with the given name is on for the request, so a dark launched route
+// looks like it does not exist.
+func RequireFeatureFlag(flags *FeatureFlags, name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !flags.Enabled(c, name) {
+			pageNotFound(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// authorizeAdmin runs the Admin check of the config, sending a 403 when it fails.
+func (f *FeatureFlags) authorizeAdmin(c *gin.Context) bool {
+	if !f.config.Admin(c) {
+		resourceError(c, ErrorForbidden, http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// AdminRoutes returns APIActions to list, read, set and delete the flags,
+// to be added with AddRoutes as private routes. Only requests passing the
+// Admin check of the config may use them. Flags set here take effect on
+// this replica at once and on the others once they refresh.
+func (f *FeatureFlags) AdminRoutes() []APIAction {
+	list := NewRoute(func(c *gin.Context) {
+		if !f.authorizeAdmin(c) {
+			return
+		}
+
+		flags := []FeatureFlag{}
+		for _, flag := range f.cached() {
+			flags = append(flags, flag)
+		}
+		sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+
+		c.JSON(http.StatusOK, flags)
+	}, "flags", GET)
+
+	get := NewRoute(func(c *gin.Context) {
+		if !f.authorizeAdmin(c) {
+			return
+		}
+
+		flag, ok := f.Lookup(c.Param("name"))
+		if !ok {
+			resourceError(c, ErrorFeatureFlagNotFound, http.StatusNotFound)
+			return
+		}
+
+		c.JSON(http.StatusOK, flag)
+	}, "flags/:name", GET)
+
+	set := NewRoute(func(c *gin.Context) {
+		if !f.authorizeAdmin(c) {
+			return
+		}
+
+		var flag FeatureFlag
+		if err := c.ShouldBindJSON(&flag); err != nil {
+			ContextErrorLogger(c, err, "Could not read feature flag.")
+			resourceError(c, ErrorInvalidFeatureFlagBody, http.StatusBadRequest)
+			return
+		}
+		if flag.Rollout != nil && (*flag.Rollout < 0 || *flag.Rollout > 100) {
+			resourceError(c, ErrorInvalidFeatureFlag, http.StatusBadRequest)
+			return
+		}
+		flag.Name = c.Param("name")
+		flag.UpdatedAt = time.Now().UTC()
+
+		if err := f.config.Store.Save(flag); err != nil {
+			resourceError(c, err, http.StatusInternalServerError)
+			return
+		}
+		ContextNormalLog(c, fmt.Sprintf("Feature flag %s set, enabled: %v.", flag.Name, flag.Enabled))
+		ContextErrorLogger(c, f.Refresh(), "Could not refresh feature flags.")
+
+		c.JSON(http.StatusOK, flag)
+	}, "flags/:name", PUT)
+
+	remove := NewRoute(func(c *gin.Context) {
+		if !f.authorizeAdmin(c) {
+			return
+		}
+
+		if err := f.config.Store.Delete(c.Param("name")); err == ErrorFeatureFlagNotFound {
+			resourceError(c, err, http.StatusNotFound)
+			return
+		} else if err != nil {
+			resourceError(c, err, http.StatusInternalServerError)
+			return
+		}
+		ContextNormalLog(c, fmt.Sprintf("Feature flag %s deleted.", c.Param("name")))
+		ContextErrorLogger(c, f.Refresh(), "Could not refresh feature flags.")
+
+		c.Status(http.StatusNoContent)
+	}, "flags/:name", DELETE)
+
+	return []APIAction{list, get, set, remove}
+}
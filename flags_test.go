@@ -0,0 +1,120 @@
+package tyrgin
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingFeatureFlagStore struct {
+	*MemoryFeatureFlagStore
+	fail  bool
+	loads int
+}
+
+func (f *failingFeatureFlagStore) All() ([]FeatureFlag, error) {
+	f.loads++
+	if f.fail {
+		return nil, ErrorMongoSessionFailure
+	}
+	return f.MemoryFeatureFlagStore.All()
+}
+
+func TestFeatureFlagEvaluate(t *testing.T) {
+	assert.False(t, FeatureFlag{Name: "beta"}.Evaluate(FlagSubject{User: "a"}))
+	assert.True(t, FeatureFlag{Name: "beta", Enabled: true}.Evaluate(FlagSubject{}))
+
+	targeted := FeatureFlag{Name: "beta", Enabled: true, Users: []string{"a"}, Roles: []string{"admin"}}
+	assert.True(t, targeted.Evaluate(FlagSubject{User: "a"}))
+	assert.True(t, targeted.Evaluate(FlagSubject{User: "b", Roles: []string{"admin"}}))
+	assert.False(t, targeted.Evaluate(FlagSubject{User: "b", Roles: []string{"student"}}))
+
+	rollout := 25
+	partial := FeatureFlag{Name: "beta", Enabled: true, Rollout: &rollout}
+	on := 0
+	for i := 0; i < 1000; i++ {
+		if partial.Evaluate(FlagSubject{User: fmt.Sprintf("user-%d", i)}) {
+			on++
+		}
+	}
+	assert.InDelta(t, 250, on, 60)
+	assert.False(t, partial.Evaluate(FlagSubject{}))
+
+	// Growing the rollout keeps users that were already in it.
+	wider := 50
+	for i := 0; i < 100; i++ {
+		subject := FlagSubject{User: fmt.Sprintf("user-%d", i)}
+		if partial.Evaluate(subject) {
+			assert.True(t, FeatureFlag{Name: "beta", Enabled: true, Rollout: &wider}.Evaluate(subject))
+		}
+	}
+}
+
+func flagsActions(flags *FeatureFlags) []APIAction {
+	grading := NewRoute(func(c *gin.Context) {
+		c.String(http.StatusOK, "new grading")
+	}, "grading", GET)
+	grading.FeatureFlag = flags.Gate("new-grading")
+
+	return append([]APIAction{grading}, flags.AdminRoutes()...)
+}
+
+func TestFeatureFlagGate(t *testing.T) {
+	flags, err := NewFeatureFlags(FeatureFlagConfig{Store: NewMemoryFeatureFlagStore()})
+	assert.Nil(t, err)
+	router := newTestRouter(flagsActions(flags), testClaims)
+
+	assert.Equal(t, http.StatusNotFound, performRequest(router, "GET", "/api/v1/tester/grading", nil, "X-User", "u1").Code)
+
+	assert.Equal(t, http.StatusForbidden, performRequest(router, "PUT", "/api/v1/tester/flags/new-grading", []byte(`{"enabled":true}`), "X-User", "u1", "X-Role", "student").Code)
+	assert.Equal(t, http.StatusForbidden, performRequest(router, "GET", "/api/v1/tester/flags", nil, "X-User", "u1").Code)
+	assert.Equal(t, http.StatusBadRequest, performRequest(router, "PUT", "/api/v1/tester/flags/new-grading", []byte(`{"enabled":"yes"}`), "X-User", "u1", "X-Role", "admin").Code)
+	assert.Equal(t, http.StatusBadRequest, performRequest(router, "PUT", "/api/v1/tester/flags/new-grading", []byte(`{"enabled":true,"rollout":101}`), "X-User", "u1", "X-Role", "admin").Code)
+	assert.Equal(t, http.StatusOK, performRequest(router, "PUT", "/api/v1/tester/flags/new-grading", []byte(`{"enabled":true,"users":["u1"]}`), "X-User", "u1", "X-Role", "admin").Code)
+
+	assert.Equal(t, http.StatusOK, performRequest(router, "GET", "/api/v1/tester/grading", nil, "X-User", "u1").Code)
+	flag, ok := flags.Lookup("new-grading")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"u1"}, flag.Users)
+
+	assert.Equal(t, http.StatusNoContent, performRequest(router, "DELETE", "/api/v1/tester/flags/new-grading", nil, "X-User", "u1", "X-Role", "admin").Code)
+	assert.Equal(t, http.StatusNotFound, performRequest(router, "DELETE", "/api/v1/tester/flags/new-grading", nil, "X-User", "u1", "X-Role", "admin").Code)
+	assert.Equal(t, http.StatusNotFound, performRequest(router, "GET", "/api/v1/tester/grading", nil, "X-User", "u1").Code)
+}
+
+func TestFeatureFlagRefresh(t *testing.T) {
+	store := NewMemoryFeatureFlagStore()
+	flags, err := NewFeatureFlags(FeatureFlagConfig{Store: store, Refresh: 10 * time.Millisecond})
+	assert.Nil(t, err)
+
+	store.Save(FeatureFlag{Name: "beta", Enabled: true})
+	_, ok := flags.Lookup("beta")
+	assert.False(t, ok)
+
+	time.Sleep(20 * time.Millisecond)
+	_, ok = flags.Lookup("beta")
+	assert.True(t, ok)
+}
+
+func TestFeatureFlagRefreshFailure(t *testing.T) {
+	store := &failingFeatureFlagStore{MemoryFeatureFlagStore: NewMemoryFeatureFlagStore()}
+	store.Save(FeatureFlag{Name: "beta", Enabled: true})
+	flags, err := NewFeatureFlags(FeatureFlagConfig{Store: store, Refresh: 50 * time.Millisecond})
+	assert.Nil(t, err)
+
+	store.fail = true
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		_, ok := flags.Lookup("beta")
+		assert.True(t, ok)
+	}
+	assert.Equal(t, 2, store.loads)
+
+	time.Sleep(60 * time.Millisecond)
+	flags.Lookup("beta")
+	assert.Equal(t, 3, store.loads)
+}
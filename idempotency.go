@@ -0,0 +1,340 @@
+package tyrgin
+
+import (
+	"bytes"
+	ctx "context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo"
+)
+
+// Idempotency headers.
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+)
+
+// Defaults for any IdempotencyConfig field left empty.
+const (
+	defaultIdempotencyTTL          = 24 * time.Hour
+	defaultIdempotencyLockTimeout  = time.Minute
+	defaultIdempotencyMaxBodyBytes = 1 << 20
+	idempotencyPollInterval        = 100 * time.Millisecond
+)
+
+// unreplayedHeaders are response headers that describe the original request
+// rather than the response, so they are not stored for replays. The encoding
+// headers are set by Compress, above the capture, for the client that made
+// the original request.
+var unreplayedHeaders = []string{
+	"Content-Encoding",
+	"Content-Length",
+	"Vary",
+	"Date",
+	RequestIDHeader,
+	"RateLimit-Limit",
+	"RateLimit-Remaining",
+	"RateLimit-Reset",
+	"Set-Cookie",
+}
+
+// Write the function to make responseCaptureWriter type part of go's
+// Writer interface.
+func (w *responseCaptureWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString copies the string into the capture before writing it.
+func (w *responseCaptureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// isUnsafeMethod reports whether method may change state on the server.
+func isUnsafeMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// hashString returns the hex encoded sha256 of data.
+func hashString(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewMemoryIdempotencyStore returns an empty MemoryIdempotencyStore.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]IdempotencyRecord)}
+}
+
+// Acquire implements IdempotencyStore.
+func (m *MemoryIdempotencyStore) Acquire(record IdempotencyRecord) (*IdempotencyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+	existing, ok := m.records[record.Key]
+	if ok && now.Before(existing.ExpireAt) && (existing.Completed || now.Before(existing.LockedUntil)) {
+		return &existing, false, nil
+	}
+
+	m.records[record.Key] = record
+	return nil, true, nil
+}
+
+// sweep occasionally drops expired records so the store does not grow
+// without bound.
+func (m *MemoryIdempotencyStore) sweep(now time.Time) {
+	m.acquires++
+	if m.acquires%1000 != 0 {
+		return
+	}
+
+	for key, record := range m.records {
+		if !now.Before(record.ExpireAt) {
+			delete(m.records, key)
+		}
+	}
+}
+
+// Complete implements IdempotencyStore.
+func (m *MemoryIdempotencyStore) Complete(record IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records[record.Key] = record
+	return nil
+}
+
+// Release implements IdempotencyStore.
+func (m *MemoryIdempotencyStore) Release(record IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.records[record.Key].Owner == record.Owner {
+		delete(m.records, record.Key)
+	}
+	return nil
+}
+
+// NewMongoIdempotencyStore returns a MongoIdempotencyStore using the named
+// collection, creating the TTL index that expires old records.
+func NewMongoIdempotencyStore(db *mongo.Database, collection string) (*MongoIdempotencyStore, error) {
+	coll := GetMongoCollection(collection, db)
+	if err := EnsureTTLIndex(coll, "expireAt"); err != nil {
+		return nil, err
+	}
+
+	return &MongoIdempotencyStore{Collection: coll}, nil
+}
+
+// Acquire implements IdempotencyStore. The insert is what makes acquiring a key
+// atomic across replicas, a record that expired or whose lock went stale is
+// only taken over if it is still unchanged.
+func (m *MongoIdempotencyStore) Acquire(record IdempotencyRecord) (*IdempotencyRecord, bool, error) {
+	_, err := m.Collection.InsertOne(ctx.Background(), record)
+	if err == nil {
+		return nil, true, nil
+	}
+	if !isDuplicateKeyError(err) {
+		return nil, false, err
+	}
+
+	var existing IdempotencyRecord
+	err = m.Collection.FindOne(ctx.Background(), bson.D{{Key: "_id", Value: record.Key}}).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		// Expired between the insert and the find, let the client retry.
+		existing.Fingerprint = record.Fingerprint
+		existing.LockedUntil = time.Now().Add(idempotencyPollInterval)
+		existing.ExpireAt = existing.LockedUntil
+		return &existing, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := time.Now()
+	if now.Before(existing.ExpireAt) && (existing.Completed || now.Before(existing.LockedUntil)) {
+		return &existing, false, nil
+	}
+
+	res, err := m.Collection.ReplaceOne(
+		ctx.Background(),
+		bson.D{
+			{Key: "_id", Value: record.Key},
+			{Key: "lockedUntil", Value: existing.LockedUntil},
+			{Key: "expireAt", Value: existing.ExpireAt},
+		},
+		record,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	if res.MatchedCount == 0 {
+		return &existing, false, nil
+	}
+
+	return nil, true, nil
+}
+
+// Complete implements IdempotencyStore.
+func (m *MongoIdempotencyStore) Complete(record IdempotencyRecord) error {
+	_, err := m.Collection.ReplaceOne(ctx.Background(), bson.D{{Key: "_id", Value: record.Key}}, record)
+	return err
+}
+
+// Release implements IdempotencyStore.
+func (m *MongoIdempotencyStore) Release(record IdempotencyRecord) error {
+	_, err := m.Collection.DeleteOne(ctx.Background(), bson.D{
+		{Key: "_id", Value: record.Key},
+		{Key: "owner", Value: record.Owner},
+	})
+	return err
+}
+
+// replayIdempotentResponse writes a stored response marked as a replay.
+func replayIdempotentResponse(c *gin.Context, record *IdempotencyRecord) {
+	for key, values := range record.Header {
+		c.Writer.Header()[key] = values
+	}
+	c.Header(IdempotencyReplayedHeader, "true")
+	c.Writer.WriteHeader(record.Status)
+	c.Writer.Write(record.Body)
+	c.Abort()
+}
+
+// Idempotency returns a middleware honouring the Idempotency-Key header on
+// unsafe methods. The first response for a key is stored and replayed for any
+// retry of the same request, marked with the Idempotent-Replayed header.
+// Retries sent while the first request is still running wait up to
+// config.Wait and then get a 409. Server errors are not stored so the
+// request can be retried. Bodies over config.MaxBodyBytes get a 413, as they
+// are read whole to tell retries apart from other requests.
+func Idempotency(config IdempotencyConfig) gin.HandlerFunc {
+	if config.Store == nil {
+		config.Store = NewMemoryIdempotencyStore()
+	}
+	if config.TTL == 0 {
+		config.TTL = defaultIdempotencyTTL
+	}
+	if config.LockTimeout == 0 {
+		config.LockTimeout = defaultIdempotencyLockTimeout
+	}
+	if config.MaxBodyBytes == 0 {
+		config.MaxBodyBytes = defaultIdempotencyMaxBodyBytes
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || !isUnsafeMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > config.MaxBodyBytes {
+			bodyTooLarge(c)
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			var err error
+			body, err = ioutil.ReadAll(&limitedBody{ReadCloser: c.Request.Body, remaining: config.MaxBodyBytes})
+			if err == ErrorRequestBodyTooLarge {
+				bodyTooLarge(c)
+				return
+			}
+			ContextErrorLogger(c, err, "Failed to read Request Body.")
+			c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+		}
+
+		// Keys are scoped to the caller so one client can never see another's response.
+		now := time.Now()
+		record := IdempotencyRecord{
+			Key:         hashString([]byte(c.Request.Method + " " + c.Request.URL.Path + " " + c.GetHeader("Authorization") + " " + key)),
+			Fingerprint: hashString(body),
+			Owner:       newRequestID(),
+			LockedUntil: now.Add(config.LockTimeout),
+			ExpireAt:    now.Add(config.TTL),
+		}
+
+		deadline := now.Add(config.Wait)
+		for {
+			existing, acquired, err := config.Store.Acquire(record)
+			if err != nil {
+				ContextErrorLogger(c, err, "Idempotency store failed, handling request without it.")
+				c.Next()
+				return
+			}
+			if acquired {
+				break
+			}
+
+			if existing.Fingerprint != record.Fingerprint {
+				ErrorHandler(ErrorIdempotencyKeyReused, c, http.StatusUnprocessableEntity, gin.H{
+					"statusCode": http.StatusUnprocessableEntity,
+					"message":    ErrorIdempotencyKeyReused.Error(),
+				})
+				return
+			}
+			if existing.Completed {
+				replayIdempotentResponse(c, existing)
+				return
+			}
+			if time.Now().After(deadline) {
+				ErrorHandler(ErrorIdempotencyConflict, c, http.StatusConflict, gin.H{
+					"statusCode": http.StatusConflict,
+					"message":    ErrorIdempotencyConflict.Error(),
+				})
+				return
+			}
+
+			time.Sleep(idempotencyPollInterval)
+		}
+
+		// Release the key unless the response is stored, also when the
+		// handler panics. Only the record of this request is released, not
+		// one another request took over since.
+		completed := false
+		defer func() {
+			if !completed {
+				ContextErrorLogger(c, config.Store.Release(record), "Failed to release Idempotency-Key.")
+			}
+		}()
+
+		writer := &responseCaptureWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			return
+		}
+
+		header := make(map[string][]string)
+		for key, values := range c.Writer.Header() {
+			header[key] = values
+		}
+		for _, key := range unreplayedHeaders {
+			delete(header, http.CanonicalHeaderKey(key))
+		}
+
+		record.Completed = true
+		record.Status = c.Writer.Status()
+		record.Header = header
+		record.Body = writer.body.Bytes()
+		completed = true
+		ContextErrorLogger(c, config.Store.Complete(record), "Failed to store idempotent response.")
+	}
+}
@@ -0,0 +1,179 @@
+package tyrgin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyReplay(t *testing.T) {
+	submissions := 0
+
+	router := gin.New()
+	router.Use(Idempotency(IdempotencyConfig{}))
+	router.POST("/submit", func(c *gin.Context) {
+		submissions++
+		c.Header("Location", "/submit/1")
+		c.JSON(http.StatusCreated, gin.H{"submissions": submissions})
+	})
+
+	first := performRequest(router, "POST", "/submit", []byte(`{"file":"a.py"}`), IdempotencyKeyHeader, "abc")
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, "", first.Header().Get(IdempotencyReplayedHeader))
+
+	replay := performRequest(router, "POST", "/submit", []byte(`{"file":"a.py"}`), IdempotencyKeyHeader, "abc")
+	assert.Equal(t, http.StatusCreated, replay.Code)
+	assert.Equal(t, "true", replay.Header().Get(IdempotencyReplayedHeader))
+	assert.Equal(t, "/submit/1", replay.Header().Get("Location"))
+	assert.Equal(t, first.Body.String(), replay.Body.String())
+	assert.Equal(t, 1, submissions)
+
+	reused := performRequest(router, "POST", "/submit", []byte(`{"file":"b.py"}`), IdempotencyKeyHeader, "abc")
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+
+	other := performRequest(router, "POST", "/submit", []byte(`{"file":"a.py"}`), IdempotencyKeyHeader, "def")
+	assert.Equal(t, http.StatusCreated, other.Code)
+	assert.Equal(t, 2, submissions)
+}
+
+func TestIdempotencyConcurrentDuplicate(t *testing.T) {
+	started := make(chan bool)
+	finish := make(chan bool)
+
+	router := gin.New()
+	router.Use(Idempotency(IdempotencyConfig{}))
+	router.POST("/submit", func(c *gin.Context) {
+		started <- true
+		<-finish
+		c.Status(http.StatusCreated)
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Equal(t, http.StatusCreated, performRequest(router, "POST", "/submit", nil, IdempotencyKeyHeader, "abc").Code)
+	}()
+
+	<-started
+	assert.Equal(t, http.StatusConflict, performRequest(router, "POST", "/submit", nil, IdempotencyKeyHeader, "abc").Code)
+	finish <- true
+	wg.Wait()
+}
+
+func TestIdempotencyServerErrorReleasesKey(t *testing.T) {
+	calls := 0
+
+	router := gin.New()
+	router.Use(Idempotency(IdempotencyConfig{Wait: time.Second}))
+	router.POST("/submit", func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusCreated)
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, performRequest(router, "POST", "/submit", nil, IdempotencyKeyHeader, "abc").Code)
+	assert.Equal(t, http.StatusCreated, performRequest(router, "POST", "/submit", nil, IdempotencyKeyHeader, "abc").Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotencyPanicReleasesKey(t *testing.T) {
+	calls := 0
+
+	router := gin.New()
+	router.Use(Recovery(), Idempotency(IdempotencyConfig{}))
+	router.POST("/submit", func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			panic("handler failed")
+		}
+		c.Status(http.StatusCreated)
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, performRequest(router, "POST", "/submit", nil, IdempotencyKeyHeader, "abc").Code)
+	assert.Equal(t, http.StatusCreated, performRequest(router, "POST", "/submit", nil, IdempotencyKeyHeader, "abc").Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotencyReplayBehindCompress(t *testing.T) {
+	router := gin.New()
+	router.Use(Compress(CompressConfig{}), Idempotency(IdempotencyConfig{}))
+	router.POST("/submit", func(c *gin.Context) {
+		c.String(http.StatusCreated, strings.Repeat("a", 10000))
+	})
+
+	req, _ := http.NewRequest("POST", "/submit", nil)
+	req.Header.Set(IdempotencyKeyHeader, "abc")
+	req.Header.Set("Accept-Encoding", "gzip")
+	first := httptest.NewRecorder()
+	router.ServeHTTP(first, req)
+	assert.Equal(t, "gzip", first.Header().Get("Content-Encoding"))
+
+	// A client that does not accept gzip gets the plain body it asked for.
+	replay := performRequest(router, "POST", "/submit", nil, IdempotencyKeyHeader, "abc")
+	assert.Equal(t, "true", replay.Header().Get(IdempotencyReplayedHeader))
+	assert.Equal(t, "", replay.Header().Get("Content-Encoding"))
+	assert.Equal(t, strings.Repeat("a", 10000), replay.Body.String())
+}
+
+func TestIdempotencyBodyLimit(t *testing.T) {
+	calls := 0
+
+	router := gin.New()
+	router.Use(Idempotency(IdempotencyConfig{MaxBodyBytes: 10}))
+	router.POST("/submit", func(c *gin.Context) {
+		calls++
+		c.Status(http.StatusCreated)
+	})
+
+	assert.Equal(t, http.StatusCreated, performRequest(router, "POST", "/submit", []byte("0123456789"), IdempotencyKeyHeader, "abc").Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, performRequest(router, "POST", "/submit", []byte("0123456789A"), IdempotencyKeyHeader, "def").Code)
+
+	// Bodies without a Content-Length are cut off while reading.
+	req, _ := http.NewRequest("POST", "/submit", ioutil.NopCloser(strings.NewReader("0123456789A")))
+	req.Header.Set(IdempotencyKeyHeader, "ghi")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	assert.Equal(t, 1, calls)
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	now := time.Now()
+
+	first := IdempotencyRecord{Key: "abc", Owner: "first", LockedUntil: now.Add(-time.Second), ExpireAt: now.Add(time.Hour)}
+	_, acquired, err := store.Acquire(first)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+
+	// The stale lock is taken over, releasing the first owner leaves it be.
+	second := IdempotencyRecord{Key: "abc", Owner: "second", LockedUntil: now.Add(time.Minute), ExpireAt: now.Add(time.Hour)}
+	_, acquired, _ = store.Acquire(second)
+	assert.True(t, acquired)
+	assert.Nil(t, store.Release(first))
+	existing, acquired, _ := store.Acquire(IdempotencyRecord{Key: "abc", Owner: "third"})
+	assert.False(t, acquired)
+	assert.Equal(t, "second", existing.Owner)
+
+	assert.Nil(t, store.Release(second))
+	_, acquired, _ = store.Acquire(IdempotencyRecord{Key: "abc", Owner: "third", ExpireAt: now.Add(-time.Second)})
+	assert.True(t, acquired)
+
+	// Expired records are swept.
+	for i := 0; i < 1000; i++ {
+		store.Acquire(IdempotencyRecord{Key: fmt.Sprint(i), ExpireAt: now.Add(-time.Second)})
+	}
+	assert.True(t, len(store.records) < 1000)
+}
@@ -0,0 +1,150 @@
+package tyrgin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Read passes reads through until the limit is passed.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, ErrorRequestBodyTooLarge
+	}
+
+	// Read one byte past the limit to tell a body of exactly the limit apart.
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = 0
+		b.exceeded = true
+		return n, ErrorRequestBodyTooLarge
+	}
+	b.remaining -= int64(n)
+
+	return n, err
+}
+
+// bodyTooLarge sends the 413 response.
+func bodyTooLarge(c *gin.Context) {
+	ErrorHandler(ErrorRequestBodyTooLarge, c, http.StatusRequestEntityTooLarge, gin.H{
+		"statusCode": http.StatusRequestEntityTooLarge,
+		"message":    ErrorRequestBodyTooLarge.Error(),
+	})
+}
+
+// BodyLimit returns a middleware limiting request bodies to max bytes. Bodies
+// that declare a larger Content-Length are refused with a 413 before anything
+// is read. Other bodies fail to read once they pass the limit, and a 413 is
+// sent if the handler did not respond itself.
+func BodyLimit(max int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > max {
+			bodyTooLarge(c)
+			return
+		}
+
+		if c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		body := &limitedBody{ReadCloser: c.Request.Body, remaining: max}
+		c.Request.Body = body
+
+		c.Next()
+
+		if body.exceeded && !c.Writer.Written() {
+			bodyTooLarge(c)
+		}
+	}
+}
+
+// Header returns the headers of the handler, kept apart from the real ones
+// until it is known whether they are sent.
+func (w *heldWriter) Header() http.Header {
+	return w.header
+}
+
+// Write keeps the body of the handler.
+func (w *heldWriter) Write(data []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(data)
+}
+
+// WriteString makes sure strings are kept like any other write.
+func (w *heldWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow marks the header as written, it is only sent once the
+// handler is done.
+func (w *heldWriter) WriteHeaderNow() {
+	w.wroteHeader = true
+}
+
+// Size returns how much the handler has written.
+func (w *heldWriter) Size() int {
+	return w.body.Len()
+}
+
+// Written reports whether the handler has responded.
+func (w *heldWriter) Written() bool {
+	return w.wroteHeader
+}
+
+// Flush is a no-op, a held response is sent in one go.
+func (w *heldWriter) Flush() {}
+
+// release sends what the handler wrote to the writer that was held back.
+func (w *heldWriter) release() {
+	for key, values := range w.header {
+		w.ResponseWriter.Header()[key] = values
+	}
+	if w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes())
+	}
+}
+
+// Timeout returns a middleware giving the rest of the handlers a deadline.
+// The context of the request is cancelled at the deadline, so handlers must
+// pass c.Request.Context() on to anything slow they call and return once it
+// is done. If the handlers finish past the deadline whatever they wrote is
+// thrown away and the client gets a 503 instead, as it is when they panic
+// so Recovery answers on the real writer. A gin.Context can not be used from
+// two goroutines, so the handlers are never abandoned mid-flight.
+func Timeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeoutCtx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(timeoutCtx)
+
+		original := c.Writer
+		writer := &heldWriter{ResponseWriter: original, header: make(http.Header)}
+		c.Writer = writer
+		defer func() {
+			c.Writer = original
+		}()
+
+		c.Next()
+
+		c.Writer = original
+		if timeoutCtx.Err() == context.DeadlineExceeded {
+			ContextErrorLogger(c, ErrorHandlerTimeout, fmt.Sprintf("Handler passed its %v deadline.", timeout))
+			ErrorHandler(ErrorHandlerTimeout, c, http.StatusServiceUnavailable, gin.H{
+				"statusCode": http.StatusServiceUnavailable,
+				"message":    ErrorHandlerTimeout.Error(),
+			})
+			return
+		}
+
+		writer.release()
+	}
+}
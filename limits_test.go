@@ -0,0 +1,94 @@
+package tyrgin
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func limitsActions(handled *int) []APIAction {
+	upload := NewRoute(func(c *gin.Context) {
+		*handled++
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			return
+		}
+		c.String(http.StatusCreated, "%d", len(body))
+	}, "upload", POST)
+	upload.MaxBodyBytes = 10
+
+	slow := NewRoute(func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+			c.String(http.StatusOK, "too late")
+		case <-time.After(time.Second):
+		}
+	}, "slow", GET)
+	slow.Timeout = 10 * time.Millisecond
+
+	fast := NewRoute(func(c *gin.Context) {
+		c.Header("X-Fast", "yes")
+		c.String(http.StatusAccepted, "fast")
+	}, "fast", GET)
+	fast.Timeout = time.Second
+
+	panics := NewRoute(func(c *gin.Context) {
+		c.Header("X-Partial", "yes")
+		c.String(http.StatusOK, "partial")
+		panic("boom")
+	}, "panics", GET)
+	panics.Timeout = time.Second
+
+	return []APIAction{upload, slow, fast, panics}
+}
+
+func TestBodyLimit(t *testing.T) {
+	handled := 0
+	router := newTestRouter(limitsActions(&handled), Logger(), Recovery())
+
+	resp := performRequest(router, "POST", "/api/v1/tester/upload", []byte("0123456789"))
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, "10", resp.Body.String())
+
+	resp = performRequest(router, "POST", "/api/v1/tester/upload", []byte("0123456789A"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	assert.Equal(t, 1, handled)
+
+	// Without a Content-Length the limit is only noticed while reading.
+	req, _ := http.NewRequest("POST", "/api/v1/tester/upload", ioutil.NopCloser(strings.NewReader("0123456789A")))
+	req.ContentLength = -1
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	assert.Equal(t, 2, handled)
+}
+
+func TestTimeout(t *testing.T) {
+	handled := 0
+	router := newTestRouter(limitsActions(&handled), Logger(), Recovery())
+
+	resp := performRequest(router, "GET", "/api/v1/tester/slow", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "application/json+error", resp.Header().Get("Content-Type"))
+	assert.False(t, bytes.Contains(resp.Body.Bytes(), []byte("too late")))
+
+	resp = performRequest(router, "GET", "/api/v1/tester/fast", nil)
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+	assert.Equal(t, "yes", resp.Header().Get("X-Fast"))
+	assert.Equal(t, "fast", resp.Body.String())
+
+	// What a panicking handler wrote is dropped for the answer of Recovery.
+	resp = performRequest(router, "GET", "/api/v1/tester/panics", nil)
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Equal(t, "application/json+error", resp.Header().Get("Content-Type"))
+	assert.Equal(t, "", resp.Header().Get("X-Partial"))
+	assert.Contains(t, resp.Body.String(), ErrorPanicRecovered.Error())
+	assert.NotContains(t, resp.Body.String(), "partial")
+}
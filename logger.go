@@ -4,11 +4,12 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
-	"io/ioutil"
-	"os"
+	"net/url"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
-	runtime "github.com/banzaicloud/logrus-runtime-formatter"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 )
@@ -34,35 +35,171 @@ func determineLogLevel(level string) log.Level {
 }
 
 func init() {
-	// Format to json because jq tool is amazing.
-	formatter := runtime.Formatter{ChildFormatter: &log.JSONFormatter{}}
-	formatter.Line = true
-	log.SetFormatter(&formatter)
-
-	// Grab log file name from enviornment. Default is log.json.
-	logFileName := os.Getenv("LOG_FILE")
-	if logFileName == "" {
-		logFileName = "log.json"
+	// Sinks are set up from LOG_SINKS, or else LOG_FILE.
+	config, err := LogConfigFromEnv()
+	if err == nil {
+		err = ConfigureLogging(config)
 	}
-	logFile, err := os.OpenFile(logFileName, os.O_WRONLY|os.O_CREATE, 0755)
 	if err != nil {
-		log.Fatal("Could not create log file. Server Quiting...")
+		log.Fatal("Could not set up logging. Server Quiting...")
 	}
-	log.SetOutput(logFile)
-
-	// Grab log level from env.
-	logLevelEnv := os.Getenv("LOG_LEVEL")
-	log.SetLevel(determineLogLevel(logLevelEnv))
 	log.Info("Logging starting...")
 }
 
 // Write the function to make buferredWriter type part of go's
 // Writer interface.
 func (b *bufferedWriter) Write(data []byte) (int, error) {
-	b.Buffer.Write(data)
+	b.size += int64(len(data))
+	if !b.uncopied && captureLimited(&b.Buffer, data, b.limit) {
+		b.truncated = true
+	}
 	return b.out.Write(data)
 }
 
+// WriteString has to go through Write as well, otherwise strings skip
+// both the copy and the buffered writer.
+func (b *bufferedWriter) WriteString(s string) (int, error) {
+	return b.Write([]byte(s))
+}
+
+// Flush sends what is held in the buffered writer before flushing the
+// response itself.
+func (b *bufferedWriter) Flush() {
+	b.out.Flush()
+	b.ResponseWriter.Flush()
+}
+
+// swap makes w the writer the response is written to, flushing what was
+// buffered for the previous writer first. The previous writer is returned
+// so it can be swapped back. This lets other middleware, such as Compress,
+// sit underneath the copy the logger keeps.
+func (b *bufferedWriter) swap(w gin.ResponseWriter) gin.ResponseWriter {
+	b.out.Flush()
+	previous := b.ResponseWriter
+	b.ResponseWriter = w
+	b.out.Reset(w)
+
+	return previous
+}
+
+// responseCaptureKey and requestCaptureKey are where Logger keeps its writer
+// and the copy of the Request Body in the gin context.
+const (
+	responseCaptureKey = "ResponseCapture"
+	requestCaptureKey  = "RequestCapture"
+)
+
+// Logger keeps at most 64KiB of each body unless configured otherwise.
+const defaultBodyCaptureLimit = 64 << 10
+
+// TruncatedSuffix ends text bodies that were logged only in part.
+const TruncatedSuffix = "...[TRUNCATED]"
+
+var bodyCaptureLimit int64 = defaultBodyCaptureLimit
+
+// captureLimited copies data into buffer as far as limit allows, reporting
+// whether any of it was left out.
+func captureLimited(buffer *bytes.Buffer, data []byte, limit int64) bool {
+	room := limit - int64(buffer.Len())
+	if room <= 0 {
+		return len(data) > 0
+	}
+	if int64(len(data)) > room {
+		buffer.Write(data[:room])
+		return true
+	}
+	buffer.Write(data)
+
+	return false
+}
+
+// StopResponseCapture stops the Logger from keeping a copy of the rest of the
+// response, for streamed or otherwise large responses. The response body is
+// then not logged.
+func StopResponseCapture(c *gin.Context) {
+	if writer, ok := c.Get(responseCaptureKey); ok {
+		captured := writer.(*bufferedWriter)
+		captured.uncopied = true
+		captured.Buffer.Reset()
+	}
+}
+
+// SkipBodyLogging a middleware to stop Logger from logging the request and
+// response bodies of a route, only their type and size are logged.
+// APIAction.SkipBodyLogging adds it to a route.
+func SkipBodyLogging() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		StopResponseCapture(c)
+		if capture, ok := c.Get(requestCaptureKey); ok {
+			captured := capture.(*requestBodyCapture)
+			captured.uncopied = true
+			captured.buffer.Reset()
+		}
+		c.Next()
+	}
+}
+
+// loggedBody returns what Logger logs of a body: decoded JSON or form values
+// with the policy applied, text cut at the capture limit or, for anything
+// else and bodies that were not kept whole, just their type and size.
+func loggedBody(policy *RedactionPolicy, contentType string, body []byte, size int64, truncated, uncopied bool) interface{} {
+	if size == 0 {
+		return nil
+	}
+
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	summary := log.Fields{"contentType": mediaType, "size": size}
+	if uncopied {
+		return summary
+	}
+
+	switch {
+	case mediaType == "" || strings.Contains(mediaType, "json"):
+		var decoded interface{}
+		if !truncated && json.Unmarshal(body, &decoded) == nil {
+			return policy.RedactJSON(decoded)
+		}
+		if mediaType != "" {
+			return summary
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if truncated || err != nil {
+			return summary
+		}
+		form := map[string]interface{}{}
+		for key, list := range values {
+			copied := make([]interface{}, len(list))
+			for i, value := range list {
+				copied[i] = value
+			}
+			form[key] = copied
+		}
+		return policy.RedactJSON(form)
+	case strings.HasPrefix(mediaType, "text/") && mediaType != "text/event-stream",
+		strings.HasSuffix(mediaType, "xml"):
+	default:
+		return summary
+	}
+
+	// Text, or something without a type that could be.
+	if truncated {
+		// The limit may have split the last character.
+		for i := 0; i < utf8.UTFMax-1 && len(body) > 0 && !utf8.Valid(body); i++ {
+			body = body[:len(body)-1]
+		}
+	}
+	if !utf8.Valid(body) {
+		return summary
+	}
+	text := policy.RedactString(string(body))
+	if truncated {
+		text += TruncatedSuffix
+	}
+
+	return text
+}
+
 // ErrorLogger takes an error and a message, if the error is not
 // null log with warning message.
 func ErrorLogger(err error, msg string) {
@@ -83,8 +220,67 @@ func NormalLog(msg string) {
 	}).Info("Message")
 }
 
+// requestFields returns the fields identifying the request handled by c that
+// are added to every log entry made for it.
+func requestFields(c *gin.Context) log.Fields {
+	fields := log.Fields{}
+	if id := GetRequestID(c); id != "" {
+		fields["requestId"] = id
+	}
+	if tenant := GetTenant(c); tenant != "" {
+		fields["tenant"] = tenant
+	}
+
+	return fields
+}
+
+// ContextLogger returns a log entry carrying the request ID of the request
+// handled by c, use it for any logging done while handling a request. It
+// logs at debug level when that was raised for the request or its user.
+func ContextLogger(c *gin.Context) *log.Entry {
+	if verboseRequest(c) {
+		return log.NewEntry(verboseLogger()).WithFields(requestFields(c))
+	}
+
+	return log.WithFields(requestFields(c))
+}
+
+// ContextErrorLogger is ErrorLogger for code handling a request.
+func ContextErrorLogger(c *gin.Context, err error, msg string) {
+
+	if err != nil {
+		ContextLogger(c).WithFields(log.Fields{
+			"error":   err,
+			"message": msg,
+		}).Warn("Code Error")
+	}
+
+}
+
+// ContextNormalLog is NormalLog for code handling a request.
+func ContextNormalLog(c *gin.Context, msg string) {
+	ContextLogger(c).WithFields(log.Fields{
+		"message": msg,
+	}).Info("Message")
+}
+
+// Read copies what is read from the Request Body into the capture, as far
+// as its limit allows.
+func (r *requestBodyCapture) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.size += int64(n)
+	if !r.uncopied && captureLimited(&r.buffer, p[:n], r.limit) {
+		r.truncated = true
+	}
+	return n, err
+}
+
 // Logger a logging middleware to be used with gin.
 // Logs standard information based of the information given.
+// The Request Body is logged as far as the handlers read it. Bodies are
+// logged as JSON, form values or text up to the capture limit, others, such
+// as uploads and streams, only by type and size. Headers, the URL and bodies
+// are redacted by the RedactionPolicy of the route, or else the current one.
 func Logger() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// before request
@@ -93,54 +289,53 @@ func Logger() gin.HandlerFunc {
 		// Give our context additional context to see response body.
 		w := bufio.NewWriter(c.Writer)
 		buff := bytes.Buffer{}
-		newWriter := &bufferedWriter{c.Writer, w, buff}
+		limit := atomic.LoadInt64(&bodyCaptureLimit)
+		newWriter := &bufferedWriter{ResponseWriter: c.Writer, out: w, Buffer: buff, limit: limit}
 
 		c.Writer = newWriter
+		c.Set(responseCaptureKey, newWriter)
 
 		// You have to manually flush the buffer at the end
 		defer func() {
 			w.Flush()
 		}()
 
-		// Get Request Body
-		var reqBody map[string]interface{}
+		// Copy the Request Body as the handlers read it.
+		var bodyCapture *requestBodyCapture
 		if c.Request.Body != nil {
-			// Read the buffer then make a copy of it
-			// to attach back to the request.
-			bytesBody, err := ioutil.ReadAll(c.Request.Body)
-			ErrorLogger(err, "Failed to read Request Body.")
-			json.Unmarshal(bytesBody, &reqBody)
-
-			if _, ok := reqBody["email"]; ok {
-				delete(reqBody, "email")
-			}
-			if _, ok := reqBody["password"]; ok {
-				delete(reqBody, "password")
-			}
-			if _, ok := reqBody["passwordConfirmation"]; ok {
-				delete(reqBody, "passwordConfirmation")
-			}
-
-			c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(bytesBody))
+			bodyCapture = &requestBodyCapture{ReadCloser: c.Request.Body, limit: limit}
+			// Uploads are never logged, so not worth copying.
+			bodyCapture.uncopied = strings.HasPrefix(c.ContentType(), "multipart/")
+			c.Request.Body = bodyCapture
+			c.Set(requestCaptureKey, bodyCapture)
 		}
 
 		c.Next()
 		//after request
 		latency := int64(time.Since(t) / time.Millisecond)
 
-		var respBody map[string]interface{}
-		if newWriter.Buffer.Bytes() != nil {
-			json.Unmarshal(newWriter.Buffer.Bytes(), &respBody)
+		policy := contextRedactionPolicy(c)
+
+		var reqBody interface{}
+		if bodyCapture != nil {
+			// Handlers may not read the whole body.
+			size := bodyCapture.size
+			if c.Request.ContentLength > size {
+				size = c.Request.ContentLength
+			}
+			reqBody = loggedBody(policy, c.ContentType(), bodyCapture.buffer.Bytes(), size, bodyCapture.truncated, bodyCapture.uncopied)
 		}
 
-		contextLog := log.WithFields(log.Fields{
+		respBody := loggedBody(policy, c.Writer.Header().Get("Content-Type"), newWriter.Buffer.Bytes(), newWriter.size, newWriter.truncated, newWriter.uncopied)
+
+		contextLog := ContextLogger(c).WithFields(log.Fields{
 			"RequestMethod":   c.Request.Method,
-			"RequestUrl":      c.Request.URL,
-			"RequestHeaders":  c.Request.Header,
+			"RequestUrl":      policy.RedactURL(c.Request.URL),
+			"RequestHeaders":  policy.RedactHeaders(c.Request.Header),
 			"RequestBody":     reqBody,
 			"ResponseStatus":  c.Writer.Status(),
 			"Latency(ms)":     latency,
-			"ResponseHeaders": c.Writer.Header(),
+			"ResponseHeaders": policy.RedactHeaders(c.Writer.Header()),
 			"ResponseBody":    respBody,
 		})
 
@@ -1 +1,100 @@
 package tyrgin
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggedBody(t *testing.T) {
+	policy := DefaultRedactionPolicy()
+
+	assert.Nil(t, loggedBody(policy, "application/json", nil, 0, false, false))
+	assert.Equal(t, map[string]interface{}{"password": RedactedValue, "name": "tyr"},
+		loggedBody(policy, "application/json; charset=utf-8", []byte(`{"password": "x", "name": "tyr"}`), 32, false, false))
+	assert.Equal(t, map[string]interface{}{"password": RedactedValue, "name": []interface{}{"tyr"}},
+		loggedBody(policy, "application/x-www-form-urlencoded", []byte(`password=x&name=tyr`), 19, false, false))
+	assert.Equal(t, "plain", loggedBody(policy, "", []byte("plain"), 5, false, false))
+	assert.Equal(t, "h"+TruncatedSuffix, loggedBody(policy, "text/plain", []byte("héllo")[:2], 6, true, false))
+
+	// Bodies that can not be logged safely or usefully only get a summary.
+	summaries := []struct {
+		contentType string
+		body        string
+		truncated   bool
+		uncopied    bool
+	}{
+		{"application/json", `{"password": "x", "na`, true, false},
+		{"application/x-www-form-urlencoded", "password=x&na", true, false},
+		{"application/octet-stream", "\x00\x01", false, false},
+		{"", "\xff\xfe", false, false},
+		{"application/json", "", false, true},
+	}
+	for _, summary := range summaries {
+		assert.Equal(t, log.Fields{"contentType": summary.contentType, "size": int64(100)},
+			loggedBody(policy, summary.contentType, []byte(summary.body), 100, summary.truncated, summary.uncopied))
+	}
+}
+
+func TestLoggerBodyCapture(t *testing.T) {
+	hooks := log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+	defer log.StandardLogger().ReplaceHooks(hooks)
+	hook := test.NewGlobal()
+
+	defer atomic.StoreInt64(&bodyCaptureLimit, atomic.LoadInt64(&bodyCaptureLimit))
+	atomic.StoreInt64(&bodyCaptureLimit, 16)
+
+	upload := NewRoute(func(c *gin.Context) {
+		file, err := c.FormFile("file")
+		assert.Nil(t, err)
+		c.String(http.StatusOK, "stored %s", file.Filename)
+	}, "upload", POST)
+	text := NewRoute(func(c *gin.Context) {
+		c.String(http.StatusOK, strings.Repeat("a", 100))
+	}, "text", GET)
+	quiet := NewRoute(func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}, "quiet", POST)
+	quiet.SkipBodyLogging = true
+
+	router := gin.New()
+	router.Use(Logger())
+	AddRoutes(router, false, nil, "1", "test", []APIAction{upload, text, quiet})
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, _ := writer.CreateFormFile("file", "notes.txt")
+	part.Write([]byte("secret notes"))
+	writer.Close()
+	req, _ := http.NewRequest("POST", "/api/v1/test/upload", bytes.NewReader(form.Bytes()))
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "stored notes.txt", w.Body.String())
+
+	entry := hook.LastEntry()
+	assert.Equal(t, log.Fields{"contentType": "multipart/form-data", "size": int64(form.Len())}, entry.Data["RequestBody"])
+	assert.Equal(t, "stored notes.txt", entry.Data["ResponseBody"])
+
+	req, _ = http.NewRequest("GET", "/api/v1/test/text", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 100, w.Body.Len())
+	assert.Equal(t, strings.Repeat("a", 16)+TruncatedSuffix, hook.LastEntry().Data["ResponseBody"])
+
+	req, _ = http.NewRequest("POST", "/api/v1/test/quiet", strings.NewReader(`{"a": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	entry = hook.LastEntry()
+	assert.Equal(t, log.Fields{"contentType": "application/json", "size": int64(8)}, entry.Data["RequestBody"])
+	assert.Equal(t, log.Fields{"contentType": "application/json", "size": int64(11)}, entry.Data["ResponseBody"])
+}
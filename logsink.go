@@ -0,0 +1,259 @@
+package tyrgin
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	runtime "github.com/banzaicloud/logrus-runtime-formatter"
+	log "github.com/sirupsen/logrus"
+)
+
+// The outputs a LogSink can name besides a file.
+const (
+	LogOutputStdout = "stdout"
+	LogOutputStderr = "stderr"
+)
+
+var (
+	logFilesMu sync.Mutex
+	logFiles   []*RotatingFile
+)
+
+// Fire writes the entry to the sink when it is at the level of the sink.
+func (s *sinkHook) Fire(entry *log.Entry) error {
+	if entry.Level > s.level {
+		return nil
+	}
+
+	// Formatters may change the data, every sink formats its own copy.
+	copied := *entry
+	copied.Data = make(log.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		copied.Data[key] = value
+	}
+
+	serialized, err := s.formatter.Format(&copied)
+	if err != nil {
+		return err
+	}
+
+	s.writer.mu.Lock()
+	defer s.writer.mu.Unlock()
+	_, err = s.writer.out.Write(serialized)
+
+	return err
+}
+
+// Levels returns all levels, the sink filters by its own level in Fire so
+// the debug entries of verbose requests reach the sinks that want them.
+func (s *sinkHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// copiedHooks returns a copy of hooks, sinks keeping their own level.
+func copiedHooks(hooks log.LevelHooks) log.LevelHooks {
+	copied := make(log.LevelHooks, len(hooks))
+	for level, list := range hooks {
+		copied[level] = append(copied[level], list...)
+	}
+
+	return copied
+}
+
+// discardFormatter formats nothing, the standard logger writes to its sinks
+// through hooks and nowhere else.
+type discardFormatter struct{}
+
+// Format implements log.Formatter.
+func (discardFormatter) Format(*log.Entry) ([]byte, error) {
+	return nil, nil
+}
+
+// LogConfigFromEnv reads the logging configuration from LOG_LEVEL and
+// LOG_SINKS, a comma separated list of sinks written as output, output:level
+// or output:level:format, where output is stdout, stderr or a file whose path
+// may hold colons too. Without
+// LOG_SINKS everything is appended to LOG_FILE, log.json by default, as JSON.
+// Files are rotated as LogRotationFromEnv reads. LOG_BODY_LIMIT is how many
+// bytes of bodies the Logger keeps.
+func LogConfigFromEnv() (LogConfig, error) {
+	config := LogConfig{Level: os.Getenv("LOG_LEVEL")}
+
+	if limit := os.Getenv("LOG_BODY_LIMIT"); limit != "" {
+		parsed, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || parsed <= 0 {
+			return LogConfig{}, ErrorInvalidLogBodyLimit
+		}
+		config.BodyLimit = parsed
+	}
+
+	rotation, err := LogRotationFromEnv()
+	if err != nil {
+		return LogConfig{}, err
+	}
+
+	sinks := strings.TrimSpace(os.Getenv("LOG_SINKS"))
+	if sinks == "" {
+		file := os.Getenv("LOG_FILE")
+		if file == "" {
+			file = "log.json"
+		}
+		config.Sinks = []LogSink{{Output: file, Rotation: rotation}}
+
+		return config, nil
+	}
+
+	for _, spec := range strings.Split(sinks, ",") {
+		sink := parseLogSink(strings.TrimSpace(spec))
+		if sink.Output == "" {
+			return LogConfig{}, ErrorInvalidLogSink
+		}
+
+		sink.Rotation = rotation
+		config.Sinks = append(config.Sinks, sink)
+	}
+
+	return config, nil
+}
+
+// parseLogSink splits a sink of LOG_SINKS from the right, so the output may
+// hold colons itself, only taking off a trailing level and format when they
+// are valid ones.
+func parseLogSink(spec string) LogSink {
+	parts := strings.Split(spec, ":")
+	last := len(parts) - 1
+	if last >= 2 && (parts[last-1] == "" || validLogLevel(parts[last-1])) && validLogFormat(parts[last]) {
+		return LogSink{Output: strings.Join(parts[:last-1], ":"), Level: parts[last-1], Format: parts[last]}
+	}
+	if last >= 1 && validLogLevel(parts[last]) {
+		return LogSink{Output: strings.Join(parts[:last], ":"), Level: parts[last]}
+	}
+
+	return LogSink{Output: spec}
+}
+
+// validLogLevel reports whether level names a level of a sink.
+func validLogLevel(level string) bool {
+	_, err := log.ParseLevel(level)
+	return err == nil
+}
+
+// validLogFormat reports whether format names a format of a sink.
+func validLogFormat(format string) bool {
+	return format == "json" || format == "text"
+}
+
+// newSinkHook opens the output of a sink and builds its formatter. Opened
+// files are returned so they can be closed once the sink is replaced.
+func newSinkHook(sink LogSink) (*sinkHook, *RotatingFile, error) {
+	level := log.TraceLevel
+	if sink.Level != "" {
+		var err error
+		if level, err = log.ParseLevel(sink.Level); err != nil {
+			return nil, nil, ErrorInvalidLogSink
+		}
+	}
+
+	formatter := sink.Formatter
+	if formatter == nil {
+		switch sink.Format {
+		case "", "json":
+			formatter = &runtime.Formatter{ChildFormatter: &log.JSONFormatter{}, Line: true}
+		case "text":
+			formatter = &runtime.Formatter{ChildFormatter: &log.TextFormatter{DisableColors: true}, Line: true}
+		default:
+			return nil, nil, ErrorInvalidLogSink
+		}
+	}
+
+	var (
+		out  io.Writer
+		file *RotatingFile
+	)
+	switch {
+	case sink.Writer != nil:
+		out = sink.Writer
+	case sink.Output == LogOutputStdout:
+		out = os.Stdout
+	case sink.Output == LogOutputStderr:
+		out = os.Stderr
+	case sink.Output != "":
+		var err error
+		file, err = OpenRotatingFile(sink.Output, sink.Rotation)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = file
+	default:
+		return nil, nil, ErrorInvalidLogSink
+	}
+
+	return &sinkHook{writer: &sinkWriter{out: out}, level: level, formatter: formatter}, file, nil
+}
+
+// ConfigureLogging sends the standard logger to the sinks of config,
+// replacing the sinks it had. Config.Level caps the level of every sink and
+// is debug when empty. Nothing is changed when a sink can not be set up.
+// Files are reopened on SIGHUP.
+func ConfigureLogging(config LogConfig) error {
+	reopenOnHangup.Do(reopenLogFilesOnHangup)
+
+	if config.BodyLimit < 0 {
+		return ErrorInvalidLogBodyLimit
+	}
+
+	hooks := []*sinkHook{}
+	files := []*RotatingFile{}
+	for _, sink := range config.Sinks {
+		hook, file, err := newSinkHook(sink)
+		if err != nil {
+			for _, opened := range files {
+				opened.Close()
+			}
+			return err
+		}
+
+		hooks = append(hooks, hook)
+		if file != nil {
+			files = append(files, file)
+		}
+	}
+
+	logger := log.StandardLogger()
+	kept := make(log.LevelHooks)
+	for level, list := range logger.Hooks {
+		for _, hook := range list {
+			if _, ok := hook.(*sinkHook); !ok {
+				kept[level] = append(kept[level], hook)
+			}
+		}
+	}
+	for _, hook := range hooks {
+		kept.Add(hook)
+	}
+
+	log.SetOutput(ioutil.Discard)
+	log.SetFormatter(discardFormatter{})
+	log.SetLevel(determineLogLevel(config.Level))
+	logger.ReplaceHooks(kept)
+
+	if config.BodyLimit == 0 {
+		config.BodyLimit = defaultBodyCaptureLimit
+	}
+	atomic.StoreInt64(&bodyCaptureLimit, config.BodyLimit)
+
+	logFilesMu.Lock()
+	previous := logFiles
+	logFiles = files
+	logFilesMu.Unlock()
+	for _, file := range previous {
+		file.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package tyrgin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func restoreLogging(t *testing.T) {
+	config, err := LogConfigFromEnv()
+	assert.Nil(t, err)
+	assert.Nil(t, ConfigureLogging(config))
+}
+
+func TestLogConfigFromEnv(t *testing.T) {
+	defer os.Setenv("LOG_SINKS", os.Getenv("LOG_SINKS"))
+
+	os.Setenv("LOG_SINKS", "")
+	config, err := LogConfigFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, []LogSink{{Output: "log.json"}}, config.Sinks)
+
+	os.Setenv("LOG_SINKS", "stdout:info:text, /var/log/tyr.json:debug,stderr")
+	config, err = LogConfigFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, []LogSink{
+		{Output: "stdout", Level: "info", Format: "text"},
+		{Output: "/var/log/tyr.json", Level: "debug"},
+		{Output: "stderr"},
+	}, config.Sinks)
+
+	os.Setenv("LOG_SINKS", `C:\logs\tyr.log:warn:json,/var/log/tyr:api.log,/var/log/tyr:api.log:debug,stdout::text`)
+	config, err = LogConfigFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, []LogSink{
+		{Output: `C:\logs\tyr.log`, Level: "warn", Format: "json"},
+		{Output: "/var/log/tyr:api.log"},
+		{Output: "/var/log/tyr:api.log", Level: "debug"},
+		{Output: "stdout", Format: "text"},
+	}, config.Sinks)
+
+	os.Setenv("LOG_SINKS", ":info:text")
+	_, err = LogConfigFromEnv()
+	assert.Equal(t, ErrorInvalidLogSink, err)
+
+	defer os.Setenv("LOG_BODY_LIMIT", os.Getenv("LOG_BODY_LIMIT"))
+	os.Setenv("LOG_SINKS", "")
+	os.Setenv("LOG_BODY_LIMIT", "1024")
+	config, err = LogConfigFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1024), config.BodyLimit)
+
+	os.Setenv("LOG_BODY_LIMIT", "-1")
+	_, err = LogConfigFromEnv()
+	assert.Equal(t, ErrorInvalidLogBodyLimit, err)
+}
+
+func TestConfigureLogging(t *testing.T) {
+	defer restoreLogging(t)
+	defer log.StandardLogger().ReplaceHooks(log.StandardLogger().ReplaceHooks(make(log.LevelHooks)))
+
+	other := test.NewGlobal()
+	var jsonOut, textOut bytes.Buffer
+	assert.Nil(t, ConfigureLogging(LogConfig{
+		Level: "info",
+		Sinks: []LogSink{
+			{Writer: &jsonOut},
+			{Writer: &textOut, Level: "warn", Format: "text"},
+		},
+	}))
+
+	log.Debug("hidden")
+	NormalLog("to json")
+	ErrorLogger(ErrorInvalidLogSink, "to both")
+
+	lines := strings.Split(strings.TrimSpace(jsonOut.String()), "\n")
+	assert.Len(t, lines, 2)
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "to json", entry["message"])
+	assert.Equal(t, "NormalLog", entry["function"])
+
+	assert.Equal(t, 1, strings.Count(textOut.String(), "\n"))
+	assert.Contains(t, textOut.String(), "level=warning")
+	assert.Contains(t, textOut.String(), `message="to both"`)
+
+	// Hooks that are not sinks are kept.
+	assert.Len(t, other.AllEntries(), 2)
+
+	assert.Equal(t, ErrorInvalidLogSink, ConfigureLogging(LogConfig{Sinks: []LogSink{{Writer: &jsonOut, Level: "loud"}}}))
+	assert.Equal(t, ErrorInvalidLogSink, ConfigureLogging(LogConfig{Sinks: []LogSink{{Writer: &jsonOut, Format: "xml"}}}))
+	assert.Equal(t, ErrorInvalidLogSink, ConfigureLogging(LogConfig{Sinks: []LogSink{{}}}))
+	NormalLog("still configured")
+	assert.Contains(t, jsonOut.String(), "still configured")
+}
+
+func TestConfigureLoggingAppends(t *testing.T) {
+	defer restoreLogging(t)
+
+	dir, err := ioutil.TempDir("", "tyrgin-logs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "log.json")
+
+	for _, message := range []string{"first start", "second start"} {
+		assert.Nil(t, ConfigureLogging(LogConfig{Sinks: []LogSink{{Output: file}}}))
+		NormalLog(message)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "first start")
+	assert.Contains(t, string(data), "second start")
+}
+
+func TestVerboseRequestKeepsSinkLevels(t *testing.T) {
+	defer restoreLogging(t)
+	defer func() {
+		verboseMu.Lock()
+		verboseTargets = []VerboseLogging{}
+		verboseMu.Unlock()
+	}()
+
+	var out, errors bytes.Buffer
+	assert.Nil(t, ConfigureLogging(LogConfig{Level: "info", Sinks: []LogSink{{Writer: &out}, {Writer: &errors, Level: "error"}}}))
+
+	verboseMu.Lock()
+	verboseTargets = []VerboseLogging{{RequestID: "trace-me", Until: time.Now().Add(time.Minute)}}
+	verboseMu.Unlock()
+
+	c, _ := gin.CreateTestContext(nil)
+	c.Set(RequestIDKey, "trace-me")
+	ContextLogger(c).Debug("verbose")
+	c.Set(RequestIDKey, "other")
+	ContextLogger(c).Debug("quiet")
+
+	assert.Contains(t, out.String(), "verbose")
+	assert.NotContains(t, out.String(), "quiet")
+	assert.Equal(t, "", errors.String())
+}
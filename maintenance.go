@@ -0,0 +1,266 @@
+package tyrgin
+
+import (
+	ctx "context"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
+)
+
+// The maintenance modes. In read-only mode only safe methods are served, in
+// full mode nothing is.
+const (
+	MaintenanceOff      MaintenanceMode = "off"
+	MaintenanceReadOnly MaintenanceMode = "read-only"
+	MaintenanceFull     MaintenanceMode = "full"
+)
+
+// maintenanceDocumentID is the _id of the document the MongoMaintenanceStore keeps.
+const maintenanceDocumentID = "maintenance"
+
+// defaultMaintenanceRetryAfter is the Retry-After, in seconds, sent when the
+// maintenance state has none.
+const defaultMaintenanceRetryAfter = 300
+
+var (
+	maintenanceMu      sync.RWMutex
+	maintenanceState   = MaintenanceState{Mode: MaintenanceOff}
+	maintenanceEnvOnce sync.Once
+)
+
+// valid reports whether mode is one of the maintenance modes.
+func (mode MaintenanceMode) valid() bool {
+	return mode == MaintenanceOff || mode == MaintenanceReadOnly || mode == MaintenanceFull
+}
+
+// maintenanceFromEnv sets the maintenance mode the service starts in from
+// MAINTENANCE_MODE, MAINTENANCE_MESSAGE and MAINTENANCE_RETRY_AFTER.
+func maintenanceFromEnv() {
+	mode := MaintenanceMode(os.Getenv("MAINTENANCE_MODE"))
+	if mode == "" {
+		return
+	}
+
+	retryAfter, _ := strconv.Atoi(os.Getenv("MAINTENANCE_RETRY_AFTER"))
+	err := setMaintenance(MaintenanceState{
+		Mode:       mode,
+		Message:    os.Getenv("MAINTENANCE_MESSAGE"),
+		RetryAfter: retryAfter,
+	})
+	ErrorLogger(err, "MAINTENANCE_MODE must be off, read-only or full.")
+}
+
+// CurrentMaintenance returns the maintenance state of the service.
+func CurrentMaintenance() MaintenanceState {
+	maintenanceEnvOnce.Do(maintenanceFromEnv)
+
+	maintenanceMu.RLock()
+	defer maintenanceMu.RUnlock()
+
+	return maintenanceState
+}
+
+// SetMaintenance changes the maintenance state of the service. An empty mode
+// is off. Since is kept while the mode stays the same.
+func SetMaintenance(state MaintenanceState) error {
+	maintenanceEnvOnce.Do(maintenanceFromEnv)
+	return setMaintenance(state)
+}
+
+// resolveMaintenance validates state and fills in the mode and Since it
+// would have if it were set now.
+func resolveMaintenance(state MaintenanceState) (MaintenanceState, error) {
+	if state.Mode == "" {
+		state.Mode = MaintenanceOff
+	}
+	if !state.Mode.valid() || state.RetryAfter < 0 {
+		return state, ErrorInvalidMaintenance
+	}
+
+	maintenanceMu.RLock()
+	defer maintenanceMu.RUnlock()
+
+	if state.Mode == maintenanceState.Mode {
+		state.Since = maintenanceState.Since
+	} else if state.Since.IsZero() {
+		state.Since = time.Now().UTC()
+	}
+
+	return state, nil
+}
+
+// setMaintenance is SetMaintenance without reading the environment first.
+func setMaintenance(state MaintenanceState) error {
+	state, err := resolveMaintenance(state)
+	if err != nil {
+		return err
+	}
+
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	if state.Mode != maintenanceState.Mode {
+		NormalLog("Maintenance mode is now " + string(state.Mode) + ".")
+	}
+	maintenanceState = state
+
+	return nil
+}
+
+// NewMongoMaintenanceStore returns a MaintenanceStore sharing the maintenance
+// state through the given collection.
+func NewMongoMaintenanceStore(db *mongo.Database, collection string) *MongoMaintenanceStore {
+	return &MongoMaintenanceStore{Collection: GetMongoCollection(collection, db)}
+}
+
+// Load implements MaintenanceStore, the mode is empty until a state was saved.
+func (m *MongoMaintenanceStore) Load() (MaintenanceState, error) {
+	var state MaintenanceState
+	err := m.Collection.FindOne(ctx.Background(), bson.D{{Key: "_id", Value: maintenanceDocumentID}}).Decode(&state)
+	if err == mongo.ErrNoDocuments {
+		return MaintenanceState{}, nil
+	}
+
+	return state, err
+}
+
+// Save implements MaintenanceStore.
+func (m *MongoMaintenanceStore) Save(state MaintenanceState) error {
+	_, err := m.Collection.ReplaceOne(
+		ctx.Background(),
+		bson.D{{Key: "_id", Value: maintenanceDocumentID}},
+		state,
+		options.Replace().SetUpsert(true),
+	)
+
+	return err
+}
+
+// SyncMaintenance applies the state in store every interval, so every replica
+// follows a switch made on any of them. While no state was saved, loading an
+// empty mode, the current one, such as from MAINTENANCE_MODE, is kept. Call
+// the returned function to stop.
+func SyncMaintenance(store MaintenanceStore, interval time.Duration) func() {
+	stop := make(chan struct{})
+	load := func() {
+		state, err := store.Load()
+		if err != nil {
+			ErrorLogger(err, "Could not load maintenance state.")
+			return
+		}
+		if state.Mode == "" {
+			return
+		}
+		ErrorLogger(SetMaintenance(state), "Stored maintenance state is not valid.")
+	}
+
+	load()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				load()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+// MaintenanceGuard returns a middleware answering with a 503 and Retry-After
+// while the service is in maintenance, or for unsafe methods while it is
+// read-only. AddRoutes adds it to every APIAction that does not set
+// IgnoreMaintenance.
+func MaintenanceGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state := CurrentMaintenance()
+		if state.Mode == MaintenanceFull || (state.Mode == MaintenanceReadOnly && isUnsafeMethod(c.Request.Method)) {
+			retryAfter := state.RetryAfter
+			if retryAfter <= 0 {
+				retryAfter = defaultMaintenanceRetryAfter
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+
+			body := gin.H{
+				"statusCode": http.StatusServiceUnavailable,
+				"message":    ErrorMaintenance.Error(),
+				"mode":       state.Mode,
+			}
+			if state.Message != "" {
+				body["details"] = state.Message
+			}
+			ErrorHandler(ErrorMaintenance, c, http.StatusServiceUnavailable, body)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// MaintenanceRoutes returns APIActions to read and switch the maintenance
+// state, to be added with AddRoutes as private routes. They keep working
+// during maintenance. Only requests passing admin, by default users with the
+// admin role, may switch it. A switch is saved to store, when there is one,
+// for the other replicas to follow before it takes effect.
+func MaintenanceRoutes(store MaintenanceStore, admin func(c *gin.Context) bool) []APIAction {
+	if admin == nil {
+		admin = adminRole(FlagSubjectFromJWT(jwt.IdentityKey))
+	}
+
+	get := NewRoute(func(c *gin.Context) {
+		c.JSON(http.StatusOK, CurrentMaintenance())
+	}, "maintenance", GET)
+	get.IgnoreMaintenance = true
+
+	set := NewRoute(func(c *gin.Context) {
+		if !admin(c) {
+			resourceError(c, ErrorForbidden, http.StatusForbidden)
+			return
+		}
+
+		var state MaintenanceState
+		if err := c.ShouldBindJSON(&state); err != nil {
+			ContextErrorLogger(c, err, "Could not read maintenance state.")
+			resourceError(c, ErrorInvalidMaintenance, http.StatusBadRequest)
+			return
+		}
+		state.Since = time.Time{}
+
+		maintenanceEnvOnce.Do(maintenanceFromEnv)
+		state, err := resolveMaintenance(state)
+		if err != nil {
+			resourceError(c, err, http.StatusBadRequest)
+			return
+		}
+
+		// Only switch once the other replicas can follow.
+		if store != nil {
+			if err := store.Save(state); err != nil {
+				resourceError(c, err, http.StatusInternalServerError)
+				return
+			}
+		}
+		ContextErrorLogger(c, setMaintenance(state), "Could not switch maintenance mode.")
+
+		c.JSON(http.StatusOK, CurrentMaintenance())
+	}, "maintenance", PUT)
+	set.IgnoreMaintenance = true
+
+	return []APIAction{get, set}
+}
@@ -0,0 +1,141 @@
+package tyrgin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryMaintenanceStore struct {
+	state MaintenanceState
+}
+
+func (m *memoryMaintenanceStore) Load() (MaintenanceState, error) {
+	return m.state, nil
+}
+
+func (m *memoryMaintenanceStore) Save(state MaintenanceState) error {
+	m.state = state
+	return nil
+}
+
+type failingMaintenanceStore struct{}
+
+func (failingMaintenanceStore) Load() (MaintenanceState, error) {
+	return MaintenanceState{}, ErrorMaintenance
+}
+
+func (failingMaintenanceStore) Save(state MaintenanceState) error {
+	return ErrorMaintenance
+}
+
+func maintenanceActions(store MaintenanceStore) []APIAction {
+	return append([]APIAction{
+		NewRoute(func(c *gin.Context) {
+			c.String(http.StatusOK, "read")
+		}, "grades", GET),
+		NewRoute(func(c *gin.Context) {
+			c.String(http.StatusOK, "written")
+		}, "grades", POST),
+	}, MaintenanceRoutes(store, nil)...)
+}
+
+func TestMaintenance(t *testing.T) {
+	defer SetMaintenance(MaintenanceState{})
+
+	store := &memoryMaintenanceStore{}
+	router := newTestRouter(maintenanceActions(store), testClaims)
+	router.GET("/status/:slug", HealthPointHandler([]StatusEndpoint{}, "./about.json", "./version.txt", nil))
+
+	w := performRequest(router, "POST", "/api/v1/tester/grades", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performRequest(router, "PUT", "/api/v1/tester/maintenance", []byte(`{"mode": "read-only"}`))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performRequest(router, "PUT", "/api/v1/tester/maintenance", []byte(`{"mode": "closed"}`), "X-Role", "admin")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performRequest(router, "PUT", "/api/v1/tester/maintenance", []byte(`{"mode": "read-only", "message": "Grading freeze", "retryAfter": 120}`), "X-Role", "admin")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, MaintenanceReadOnly, store.state.Mode)
+	assert.False(t, store.state.Since.IsZero())
+
+	w = performRequest(router, "GET", "/api/v1/tester/grades", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performRequest(router, "POST", "/api/v1/tester/grades", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "120", w.Header().Get("Retry-After"))
+	var resp map[string]interface{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, ErrorMaintenance.Error(), resp["message"])
+	assert.Equal(t, "Grading freeze", resp["details"])
+
+	w = performRequest(router, "PUT", "/api/v1/tester/maintenance", []byte(`{"mode": "full"}`), "X-Role", "admin")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performRequest(router, "GET", "/api/v1/tester/grades", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "300", w.Header().Get("Retry-After"))
+
+	w = performRequest(router, "GET", "/status/about", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "full", resp["maintenance"])
+
+	w = performRequest(router, "GET", "/api/v1/tester/maintenance", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performRequest(router, "PUT", "/api/v1/tester/maintenance", []byte(`{"mode": "off"}`), "X-Role", "admin")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performRequest(router, "GET", "/api/v1/tester/grades", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSetMaintenanceKeepsSince(t *testing.T) {
+	defer SetMaintenance(MaintenanceState{})
+
+	assert.Nil(t, SetMaintenance(MaintenanceState{Mode: MaintenanceFull}))
+	since := CurrentMaintenance().Since
+	assert.Nil(t, SetMaintenance(MaintenanceState{Mode: MaintenanceFull, Message: "Still grading"}))
+	assert.Equal(t, since, CurrentMaintenance().Since)
+	assert.Equal(t, "Still grading", CurrentMaintenance().Message)
+
+	assert.Equal(t, ErrorInvalidMaintenance, SetMaintenance(MaintenanceState{Mode: "closed"}))
+	assert.Equal(t, ErrorInvalidMaintenance, SetMaintenance(MaintenanceState{Mode: MaintenanceFull, RetryAfter: -1}))
+}
+
+func TestSyncMaintenance(t *testing.T) {
+	defer SetMaintenance(MaintenanceState{})
+
+	store := &memoryMaintenanceStore{state: MaintenanceState{Mode: MaintenanceReadOnly}}
+	stop := SyncMaintenance(store, time.Hour)
+	defer stop()
+
+	assert.Equal(t, MaintenanceReadOnly, CurrentMaintenance().Mode)
+}
+
+func TestSyncMaintenanceWithoutState(t *testing.T) {
+	defer SetMaintenance(MaintenanceState{})
+
+	assert.Nil(t, SetMaintenance(MaintenanceState{Mode: MaintenanceFull}))
+	stop := SyncMaintenance(&memoryMaintenanceStore{}, time.Hour)
+	defer stop()
+
+	assert.Equal(t, MaintenanceFull, CurrentMaintenance().Mode)
+}
+
+func TestMaintenanceSaveFailureKeepsState(t *testing.T) {
+	defer SetMaintenance(MaintenanceState{})
+
+	router := newTestRouter(maintenanceActions(failingMaintenanceStore{}), testClaims)
+	w := performRequest(router, "PUT", "/api/v1/tester/maintenance", []byte(`{"mode": "full"}`), "X-Role", "admin")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, MaintenanceOff, CurrentMaintenance().Mode)
+}
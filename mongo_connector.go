@@ -94,6 +94,33 @@ func GetMongoCollectionCreate(c string, db *mongo.Database) (*mongo.Collection,
 	return collection, nil
 }
 
+// EnsureTTLIndex creates a TTL index on field so mongo removes documents once the
+// time stored in that field has passed.
+func EnsureTTLIndex(collection *mongo.Collection, field string) error {
+	_, err := collection.Indexes().CreateOne(ctx.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: field, Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+
+	return err
+}
+
+// isDuplicateKeyError reports whether err is mongo's duplicate key write error.
+func isDuplicateKeyError(err error) bool {
+	writeErrors, ok := err.(mongo.WriteErrors)
+	if !ok {
+		return false
+	}
+
+	for _, writeError := range writeErrors {
+		if writeError.Code == 11000 {
+			return true
+		}
+	}
+
+	return false
+}
+
 // GetGridFSBucket returns a mongo gridfs bucket given a  name and chunk size in bytes for a bucket.
 func GetGridFSBucket(db *mongo.Database, name string, size int32) (*Bucket, error) {
 	bucketOptions := options.GridFSBucket()
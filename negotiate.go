@@ -0,0 +1,346 @@
+package tyrgin
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugorji/go/codec"
+)
+
+// The formats responses can be rendered in, and the query parameter that
+// picks one over the Accept header.
+const (
+	FormatJSON    = "json"
+	FormatXML     = "xml"
+	FormatCSV     = "csv"
+	FormatMsgPack = "msgpack"
+
+	FormatQueryParam = "format"
+)
+
+// formatMediaTypes are the media types of each format, the first is the one
+// responses are sent with.
+var formatMediaTypes = map[string][]string{
+	FormatJSON:    {"application/json"},
+	FormatXML:     {"application/xml", "text/xml"},
+	FormatCSV:     {"text/csv"},
+	FormatMsgPack: {"application/msgpack", "application/x-msgpack"},
+}
+
+// errorFormats are the formats errors are rendered in, errors are not tables
+// so never CSV.
+var errorFormats = []string{FormatJSON, FormatXML, FormatMsgPack}
+
+// acceptQualities parses an Accept style header into the quality of each of
+// its values.
+func acceptQualities(accept string) map[string]float64 {
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(fields[0]))
+		if value == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		qualities[value] = quality
+	}
+
+	return qualities
+}
+
+// mediaTypeQuality returns how acceptable a media type is, trying the exact
+// type before its wildcards.
+func mediaTypeQuality(qualities map[string]float64, mediaType string) (float64, bool) {
+	if quality, ok := qualities[mediaType]; ok {
+		return quality, true
+	}
+	if quality, ok := qualities[strings.SplitN(mediaType, "/", 2)[0]+"/*"]; ok {
+		return quality, true
+	}
+	quality, ok := qualities["*/*"]
+	return quality, ok
+}
+
+// NegotiateFormat picks one of the offered formats for the request handled
+// by c. The format query parameter wins over the Accept header, without
+// either the first offered format is used. Browsers, which accept text/html,
+// get the first offered format too since they accept XML over anything else.
+// ErrorNotAcceptable is returned when the client accepts none of them.
+func NegotiateFormat(c *gin.Context, offered []string) (string, error) {
+	formats, err := acceptableFormats(c, offered)
+	if err != nil {
+		return "", err
+	}
+
+	return formats[0], nil
+}
+
+// acceptableFormats returns the offered formats the client accepts, the one
+// NegotiateFormat picks first and the rest from the most to the least
+// acceptable. A client without a preference accepts them all in order.
+func acceptableFormats(c *gin.Context, offered []string) ([]string, error) {
+	if format := strings.ToLower(c.Query(FormatQueryParam)); format != "" {
+		for _, candidate := range offered {
+			if candidate == format {
+				return []string{format}, nil
+			}
+		}
+		return nil, ErrorNotAcceptable
+	}
+
+	qualities := acceptQualities(c.GetHeader("Accept"))
+	if _, browser := qualities["text/html"]; browser || len(qualities) == 0 {
+		return offered, nil
+	}
+
+	formats := []string{}
+	formatQualities := map[string]float64{}
+	for _, format := range offered {
+		for _, mediaType := range formatMediaTypes[format] {
+			if quality, ok := mediaTypeQuality(qualities, mediaType); ok && quality > formatQualities[format] {
+				formatQualities[format] = quality
+			}
+		}
+		if formatQualities[format] > 0 {
+			formats = append(formats, format)
+		}
+	}
+	if len(formats) == 0 {
+		return nil, ErrorNotAcceptable
+	}
+
+	sort.SliceStable(formats, func(i, j int) bool {
+		return formatQualities[formats[i]] > formatQualities[formats[j]]
+	})
+
+	return formats, nil
+}
+
+// isStructSlice reports whether data is a slice or array of structs, or of
+// pointers to them, which is what can be rendered as CSV.
+func isStructSlice(data interface{}) bool {
+	kind := reflect.TypeOf(data)
+	if kind == nil || (kind.Kind() != reflect.Slice && kind.Kind() != reflect.Array) {
+		return false
+	}
+
+	elem := kind.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	return elem.Kind() == reflect.Struct && elem != reflect.TypeOf(time.Time{})
+}
+
+// csvColumnName returns the column of a struct field, named by its csv or
+// json tag or else the field, and false for fields that are left out.
+func csvColumnName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+
+	for _, key := range []string{"csv", "json"} {
+		if tag, ok := field.Tag.Lookup(key); ok {
+			name := strings.Split(tag, ",")[0]
+			if name == "-" {
+				return "", false
+			}
+			if name != "" {
+				return name, true
+			}
+		}
+	}
+
+	return field.Name, true
+}
+
+// csvCell writes a value as a CSV cell. Strings and times are written as
+// they are, anything else as its JSON, unquoted when that is a string. Text
+// spreadsheets would run as a formula is escaped with a leading quote.
+func csvCell(value reflect.Value) string {
+	if value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return ""
+		}
+	}
+
+	switch v := value.Interface().(type) {
+	case string:
+		return csvEscapeFormula(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+
+	encoded, err := json.Marshal(value.Interface())
+	if err != nil {
+		return csvEscapeFormula(fmt.Sprint(value.Interface()))
+	}
+
+	var s string
+	if json.Unmarshal(encoded, &s) == nil {
+		return csvEscapeFormula(s)
+	}
+	if string(encoded) == "null" {
+		return ""
+	}
+
+	var number float64
+	if json.Unmarshal(encoded, &number) == nil {
+		return string(encoded)
+	}
+
+	return csvEscapeFormula(string(encoded))
+}
+
+// csvEscapeFormula prefixes text starting like a spreadsheet formula with a
+// quote, so opening an export can not run whatever a user wrote in it.
+func csvEscapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+
+	return s
+}
+
+// encodeCSV writes a slice of structs as CSV with a header row.
+func encodeCSV(data interface{}) ([]byte, error) {
+	rows := reflect.ValueOf(data)
+	elem := rows.Type().Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	header := []string{}
+	columns := []int{}
+	for i := 0; i < elem.NumField(); i++ {
+		if name, ok := csvColumnName(elem.Field(i)); ok {
+			header = append(header, name)
+			columns = append(columns, i)
+		}
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(header)
+	for i := 0; i < rows.Len(); i++ {
+		row := rows.Index(i)
+		if row.Kind() == reflect.Ptr {
+			if row.IsNil() {
+				continue
+			}
+			row = row.Elem()
+		}
+
+		record := make([]string, len(columns))
+		for j, column := range columns {
+			record[j] = csvCell(row.Field(column))
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+
+	return buf.Bytes(), writer.Error()
+}
+
+// encodeXML encodes data as XML, wrapping slices in an items element since
+// XML needs a single root.
+func encodeXML(data interface{}) ([]byte, error) {
+	body, err := xml.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := reflect.TypeOf(data)
+	if kind != nil && (kind.Kind() == reflect.Slice || kind.Kind() == reflect.Array) && kind.Elem().Kind() != reflect.Uint8 {
+		body = append(append([]byte("<items>"), body...), "</items>"...)
+	}
+
+	return body, nil
+}
+
+// encodeFormat encodes data in a format, returning it with its content type.
+func encodeFormat(format string, data interface{}) ([]byte, string, error) {
+	var (
+		body []byte
+		err  error
+	)
+
+	switch format {
+	case FormatXML:
+		body, err = encodeXML(data)
+	case FormatCSV:
+		body, err = encodeCSV(data)
+	case FormatMsgPack:
+		err = codec.NewEncoderBytes(&body, new(codec.MsgpackHandle)).Encode(data)
+	default:
+		body, err = json.Marshal(data)
+	}
+
+	contentType := formatMediaTypes[format][0]
+	if format != FormatMsgPack {
+		contentType += "; charset=utf-8"
+	}
+
+	return body, contentType, err
+}
+
+// Render sends data with the status code in the format the client asks for
+// with the Accept header or the format query parameter: JSON, XML,
+// MessagePack or, for slices of structs, CSV. JSON is sent when the client
+// has no preference. When data can not be encoded in a format the next one
+// the client accepts is tried, a client accepting none of them gets a 406.
+func Render(c *gin.Context, code int, data interface{}) {
+	addVary(c.Writer.Header(), "Accept")
+
+	offered := errorFormats
+	if isStructSlice(data) {
+		offered = []string{FormatJSON, FormatXML, FormatCSV, FormatMsgPack}
+	}
+
+	formats, err := acceptableFormats(c, offered)
+	if err != nil {
+		notAcceptable(c, offered)
+		return
+	}
+
+	for _, format := range formats {
+		body, contentType, err := encodeFormat(format, data)
+		if err != nil {
+			ContextErrorLogger(c, err, fmt.Sprintf("Could not render response as %s.", format))
+			continue
+		}
+
+		c.Data(code, contentType, body)
+		return
+	}
+
+	notAcceptable(c, offered)
+}
+
+// notAcceptable sends the 406 naming the formats that could be sent.
+func notAcceptable(c *gin.Context, offered []string) {
+	ErrorHandler(ErrorNotAcceptable, c, http.StatusNotAcceptable, gin.H{
+		"statusCode": http.StatusNotAcceptable,
+		"message":    ErrorNotAcceptable.Error(),
+		"formats":    offered,
+	})
+}
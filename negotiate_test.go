@@ -0,0 +1,144 @@
+package tyrgin
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
+)
+
+type negotiateGrade struct {
+	ID        primitive.ObjectID `json:"id" xml:"id"`
+	Student   string             `json:"student" xml:"student"`
+	Score     float64            `json:"score" xml:"score"`
+	Late      *bool              `json:"late,omitempty" xml:"late,omitempty"`
+	Tags      []string           `csv:"labels" json:"tags" xml:"tags"`
+	Submitted time.Time          `json:"submitted" xml:"submitted"`
+	secret    string
+	Notes     string `json:"-" xml:"-"`
+}
+
+func negotiateActions() []APIAction {
+	id, _ := primitive.ObjectIDFromHex("5c6b1f1e8d1e4a2b3c4d5e6f")
+	late := true
+	grades := []negotiateGrade{
+		{ID: id, Student: "Ada, L.", Score: 97.5, Late: &late, Tags: []string{"hw1"}, Submitted: time.Date(2019, 2, 20, 10, 0, 0, 0, time.UTC), secret: "x", Notes: "y"},
+		{ID: id, Student: "Grace", Score: 88, Submitted: time.Date(2019, 2, 21, 10, 0, 0, 0, time.UTC)},
+	}
+
+	return []APIAction{
+		NewRoute(func(c *gin.Context) {
+			Render(c, http.StatusOK, grades)
+		}, "grades", GET),
+		NewRoute(func(c *gin.Context) {
+			Render(c, http.StatusOK, gin.H{"student": "Ada"})
+		}, "grade", GET),
+		NewRoute(func(c *gin.Context) {
+			Render(c, http.StatusOK, map[string]interface{}{"name": "=HYPERLINK(\"x\")"})
+		}, "course", GET),
+		NewRoute(func(c *gin.Context) {
+			ErrorHandler(ErrorResourceNotFound, c, http.StatusNotFound, gin.H{
+				"statusCode": http.StatusNotFound,
+				"message":    ErrorResourceNotFound.Error(),
+			})
+		}, "missing", GET),
+	}
+}
+
+func TestRenderFormats(t *testing.T) {
+	router := newTestRouter(negotiateActions())
+
+	w := performRequest(router, "GET", "/api/v1/tester/grades", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept", w.Header().Get("Vary"))
+	var grades []map[string]interface{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &grades))
+	assert.Len(t, grades, 2)
+
+	w = performRequest(router, "GET", "/api/v1/tester/grades", nil, "Accept", "text/csv")
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "id,student,score,late,labels,submitted\n"+
+		"5c6b1f1e8d1e4a2b3c4d5e6f,\"Ada, L.\",97.5,true,\"[\"\"hw1\"\"]\",2019-02-20T10:00:00Z\n"+
+		"5c6b1f1e8d1e4a2b3c4d5e6f,Grace,88,,,2019-02-21T10:00:00Z\n", w.Body.String())
+
+	w = performRequest(router, "GET", "/api/v1/tester/grades?format=xml", nil, "Accept", "text/csv")
+	assert.Equal(t, "application/xml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<student>Ada, L.</student>")
+	var list struct {
+		Grades []struct {
+			Student string `xml:"student"`
+		} `xml:"negotiateGrade"`
+	}
+	assert.Nil(t, xml.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Grades, 2)
+
+	w = performRequest(router, "GET", "/api/v1/tester/grades", nil, "Accept", "application/xml;q=0.5, application/x-msgpack")
+	assert.Equal(t, "application/msgpack", w.Header().Get("Content-Type"))
+	var decoded []map[string]interface{}
+	assert.Nil(t, codec.NewDecoderBytes(w.Body.Bytes(), new(codec.MsgpackHandle)).Decode(&decoded))
+	assert.Len(t, decoded, 2)
+
+	w = performRequest(router, "GET", "/api/v1/tester/grades", nil, "Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	w = performRequest(router, "GET", "/api/v1/tester/grade", nil, "Accept", "text/csv")
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	assert.Equal(t, "application/json+error", w.Header().Get("Content-Type"))
+
+	w = performRequest(router, "GET", "/api/v1/tester/grade?format=yaml", nil)
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+
+	w = performRequest(router, "GET", "/api/v1/tester/grade", nil, "Accept", "text/*")
+	assert.Equal(t, "application/xml; charset=utf-8", w.Header().Get("Content-Type"))
+
+	// Maps are not XML, the next format the client accepts is sent instead.
+	w = performRequest(router, "GET", "/api/v1/tester/course", nil, "Accept", "application/xml, application/json;q=0.5")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	w = performRequest(router, "GET", "/api/v1/tester/course", nil, "Accept", "application/xml")
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+}
+
+func TestCSVCellFormula(t *testing.T) {
+	assert.Equal(t, "'=SUM(A1:A2)", csvCell(reflect.ValueOf("=SUM(A1:A2)")))
+	assert.Equal(t, "'+1", csvCell(reflect.ValueOf("+1")))
+	assert.Equal(t, "'-2+3", csvCell(reflect.ValueOf("-2+3")))
+	assert.Equal(t, "'@cmd", csvCell(reflect.ValueOf("@cmd")))
+	assert.Equal(t, "'-x", csvCell(reflect.ValueOf(json.RawMessage(`"-x"`))))
+	assert.Equal(t, "-5", csvCell(reflect.ValueOf(-5)))
+	assert.Equal(t, "a=b", csvCell(reflect.ValueOf("a=b")))
+}
+
+func TestErrorHandlerNegotiates(t *testing.T) {
+	router := newTestRouter(negotiateActions())
+
+	w := performRequest(router, "GET", "/api/v1/tester/missing", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/json+error", w.Header().Get("Content-Type"))
+
+	w = performRequest(router, "GET", "/api/v1/tester/missing", nil, "Accept", "application/xml")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/xml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<message>"+ErrorResourceNotFound.Error()+"</message>")
+
+	w = performRequest(router, "GET", "/api/v1/tester/missing?format=msgpack", nil)
+	assert.Equal(t, "application/msgpack", w.Header().Get("Content-Type"))
+	var decoded map[string]interface{}
+	assert.Nil(t, codec.NewDecoderBytes(w.Body.Bytes(), new(codec.MsgpackHandle)).Decode(&decoded))
+
+	// Errors are not tables, asking for CSV still gets the JSON error.
+	w = performRequest(router, "GET", "/api/v1/tester/missing", nil, "Accept", "text/csv")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/json+error", w.Header().Get("Content-Type"))
+	assert.True(t, bytes.Contains(w.Body.Bytes(), []byte(ErrorResourceNotFound.Error())))
+}
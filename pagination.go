@@ -0,0 +1,197 @@
+package tyrgin
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
+)
+
+const (
+	defaultPaginationLimit    int64 = 20
+	defaultPaginationMaxLimit int64 = 100
+)
+
+// TotalCountHeader is the response header carrying the total number of items.
+const TotalCountHeader = "X-Total-Count"
+
+// parseQueryInt parses the query parameter key of c, ok is false when it is
+// not given.
+func parseQueryInt(c *gin.Context, key string) (value int64, ok bool, err error) {
+	raw, ok := c.GetQuery(key)
+	if !ok {
+		return 0, false, nil
+	}
+
+	value, err = strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, true, ErrorInvalidPagination
+	}
+
+	return value, true, nil
+}
+
+// ParsePagination reads the limit, and either the page, offset or cursor,
+// query parameters of c. The limit defaults to DefaultLimit and is capped at
+// MaxLimit. Pages start at 1. The cursor is the nextCursor of the previous
+// page. Invalid or conflicting parameters return ErrorInvalidPagination,
+// which handlers should answer with a 400.
+func ParsePagination(c *gin.Context, config PaginationConfig) (Pagination, error) {
+	if config.DefaultLimit <= 0 {
+		config.DefaultLimit = defaultPaginationLimit
+	}
+	if config.MaxLimit <= 0 {
+		config.MaxLimit = defaultPaginationMaxLimit
+	}
+
+	p := Pagination{Limit: config.DefaultLimit}
+
+	limit, ok, err := parseQueryInt(c, "limit")
+	if err != nil || (ok && limit < 1) {
+		return p, ErrorInvalidPagination
+	}
+	if ok {
+		p.Limit = limit
+	}
+	if p.Limit > config.MaxLimit {
+		p.Limit = config.MaxLimit
+	}
+
+	page, hasPage, err := parseQueryInt(c, "page")
+	if err != nil || (hasPage && page < 1) {
+		return p, ErrorInvalidPagination
+	}
+	offset, hasOffset, err := parseQueryInt(c, "offset")
+	if err != nil || (hasOffset && offset < 0) {
+		return p, ErrorInvalidPagination
+	}
+	cursor, hasCursor := c.GetQuery("cursor")
+
+	given := 0
+	for _, has := range []bool{hasPage, hasOffset, hasCursor} {
+		if has {
+			given++
+		}
+	}
+	if given > 1 {
+		return p, ErrorInvalidPagination
+	}
+
+	switch {
+	case hasPage:
+		// Pages past what an offset can hold would overflow into a negative one.
+		if page-1 > math.MaxInt64/p.Limit {
+			return p, ErrorInvalidPagination
+		}
+		p.Offset = (page - 1) * p.Limit
+	case hasOffset:
+		p.Offset = offset
+	case hasCursor:
+		after, err := primitive.ObjectIDFromHex(cursor)
+		if err != nil {
+			return p, ErrorInvalidPagination
+		}
+		p.Cursor = cursor
+		p.after = after
+	}
+
+	return p, nil
+}
+
+// FindOptions returns the options to find the page with. Cursor pages are
+// sorted by _id, which the cursor depends on.
+func (p Pagination) FindOptions() *options.FindOptions {
+	opts := options.Find().SetLimit(p.Limit)
+	if p.Cursor != "" {
+		return opts.SetSort(bson.D{{Key: "_id", Value: 1}})
+	}
+
+	return opts.SetSkip(p.Offset)
+}
+
+// Filter returns filter with what is needed to start after the cursor added,
+// leaving filter itself as it is.
+func (p Pagination) Filter(filter bson.D) bson.D {
+	if p.Cursor == "" {
+		return filter
+	}
+
+	filtered := make(bson.D, len(filter), len(filter)+1)
+	copy(filtered, filter)
+
+	return append(filtered, bson.E{Key: "_id", Value: bson.D{{Key: "$gt", Value: p.after}}})
+}
+
+// NextCursor returns the cursor for the page after the one ending with the
+// document with the given _id.
+func NextCursor(lastID primitive.ObjectID) string {
+	return lastID.Hex()
+}
+
+// pageLink returns the URL of the request with the pagination parameters
+// replaced by params.
+func pageLink(c *gin.Context, params map[string]string, rel string) string {
+	query := c.Request.URL.Query()
+	for _, key := range []string{"page", "offset", "cursor"} {
+		query.Del(key)
+	}
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	link := url.URL{Path: c.Request.URL.Path, RawQuery: query.Encode()}
+
+	return fmt.Sprintf(`<%s>; rel="%s"`, link.String(), rel)
+}
+
+// WritePage responds with data wrapped in a PageResponse, along with a Link
+// header for the first, previous, next and last pages and the total count
+// header. A negative total means it is unknown, as with cursor pagination,
+// and nextCursor is empty when there is no next page.
+func WritePage(c *gin.Context, p Pagination, data interface{}, total int64, nextCursor string) {
+	limit := strconv.FormatInt(p.Limit, 10)
+	info := PageInfo{Limit: p.Limit, Offset: p.Offset, NextCursor: nextCursor}
+	links := []string{}
+
+	if total >= 0 {
+		info.Total = &total
+		c.Header(TotalCountHeader, strconv.FormatInt(total, 10))
+	}
+
+	if p.Cursor != "" || nextCursor != "" {
+		if nextCursor != "" {
+			links = append(links, pageLink(c, map[string]string{"limit": limit, "cursor": nextCursor}, "next"))
+		}
+	} else {
+		links = append(links, pageLink(c, map[string]string{"limit": limit, "offset": "0"}, "first"))
+		if p.Offset > 0 {
+			previous := p.Offset - p.Limit
+			if previous < 0 {
+				previous = 0
+			}
+			links = append(links, pageLink(c, map[string]string{"limit": limit, "offset": strconv.FormatInt(previous, 10)}, "prev"))
+		}
+		if total >= 0 {
+			if p.Offset+p.Limit < total {
+				links = append(links, pageLink(c, map[string]string{"limit": limit, "offset": strconv.FormatInt(p.Offset+p.Limit, 10)}, "next"))
+			}
+			last := int64(0)
+			if total > 0 {
+				last = (total - 1) / p.Limit * p.Limit
+			}
+			links = append(links, pageLink(c, map[string]string{"limit": limit, "offset": strconv.FormatInt(last, 10)}, "last"))
+		}
+	}
+
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+
+	c.JSON(http.StatusOK, PageResponse{Data: data, Page: info})
+}
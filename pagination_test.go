@@ -0,0 +1,94 @@
+package tyrgin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+	"github.com/stretchr/testify/assert"
+)
+
+func paginationActions(total int64) []APIAction {
+	return []APIAction{NewRoute(func(c *gin.Context) {
+		p, err := ParsePagination(c, PaginationConfig{MaxLimit: 50})
+		if err != nil {
+			ErrorHandler(err, c, http.StatusBadRequest, gin.H{
+				"statusCode": http.StatusBadRequest,
+				"message":    err.Error(),
+			})
+			return
+		}
+
+		nextCursor := ""
+		if p.Cursor != "" {
+			total = -1
+			nextCursor = p.Cursor
+		}
+		WritePage(c, p, []string{"a", "b"}, total, nextCursor)
+	}, "items", GET)}
+}
+
+func TestParsePagination(t *testing.T) {
+	router := newTestRouter(paginationActions(95))
+
+	for _, path := range []string{"/api/v1/tester/items?limit=0", "/api/v1/tester/items?limit=x", "/api/v1/tester/items?page=0", "/api/v1/tester/items?offset=-1", "/api/v1/tester/items?page=1&offset=10", "/api/v1/tester/items?cursor=nope", "/api/v1/tester/items?page=9223372036854775807"} {
+		resp := performRequest(router, "GET", path, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, path)
+	}
+
+	var response PageResponse
+	resp := performRequest(router, "GET", "/api/v1/tester/items?limit=500", nil)
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &response))
+	assert.Equal(t, int64(50), response.Page.Limit)
+
+	resp = performRequest(router, "GET", "/api/v1/tester/items?page=3&limit=10", nil)
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &response))
+	assert.Equal(t, int64(20), response.Page.Offset)
+	assert.Equal(t, int64(95), *response.Page.Total)
+	assert.Equal(t, []interface{}{"a", "b"}, response.Data)
+}
+
+func TestWritePageLinks(t *testing.T) {
+	router := newTestRouter(paginationActions(95))
+
+	resp := performRequest(router, "GET", "/api/v1/tester/items?q=hw&page=3&limit=10", nil)
+	assert.Equal(t, "95", resp.Header().Get(TotalCountHeader))
+	assert.Equal(t,
+		`</api/v1/tester/items?limit=10&offset=0&q=hw>; rel="first", `+
+			`</api/v1/tester/items?limit=10&offset=10&q=hw>; rel="prev", `+
+			`</api/v1/tester/items?limit=10&offset=30&q=hw>; rel="next", `+
+			`</api/v1/tester/items?limit=10&offset=90&q=hw>; rel="last"`,
+		resp.Header().Get("Link"))
+
+	resp = performRequest(router, "GET", "/api/v1/tester/items?offset=90&limit=10", nil)
+	assert.NotContains(t, resp.Header().Get("Link"), `rel="next"`)
+
+	cursor := primitive.NewObjectID().Hex()
+	resp = performRequest(router, "GET", "/api/v1/tester/items?cursor="+cursor, nil)
+	assert.Equal(t, "", resp.Header().Get(TotalCountHeader))
+	assert.Equal(t, `</api/v1/tester/items?cursor=`+cursor+`&limit=20>; rel="next"`, resp.Header().Get("Link"))
+}
+
+func TestPaginationMongo(t *testing.T) {
+	p := Pagination{Limit: 10, Offset: 30}
+	opts := p.FindOptions()
+	assert.Equal(t, int64(10), *opts.Limit)
+	assert.Equal(t, int64(30), *opts.Skip)
+	assert.Equal(t, bson.D{}, p.Filter(bson.D{}))
+
+	id := primitive.NewObjectID()
+	p = Pagination{Limit: 10, Cursor: NextCursor(id), after: id}
+	opts = p.FindOptions()
+	assert.Nil(t, opts.Skip)
+	assert.Equal(t, bson.D{{Key: "_id", Value: 1}}, opts.Sort)
+	assert.Equal(t, bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: id}}}}, p.Filter(bson.D{}))
+
+	// Filter must not write into the spare capacity of a shared filter.
+	base := make(bson.D, 1, 2)
+	base[0] = bson.E{Key: "course", Value: "cs146"}
+	assert.Len(t, p.Filter(base), 2)
+	assert.Equal(t, bson.E{}, base[:2][1])
+}
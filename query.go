@@ -0,0 +1,241 @@
+package tyrgin
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+)
+
+// The operators a filter can use, written as a suffix of the field such as
+// due_lt. Equality has no suffix. In and NotIn take comma separated values.
+const (
+	FilterEq    FilterOperator = "eq"
+	FilterNe    FilterOperator = "ne"
+	FilterLt    FilterOperator = "lt"
+	FilterLte   FilterOperator = "lte"
+	FilterGt    FilterOperator = "gt"
+	FilterGte   FilterOperator = "gte"
+	FilterIn    FilterOperator = "in"
+	FilterNotIn FilterOperator = "nin"
+)
+
+// The types filter values are coerced to.
+const (
+	FilterString   FilterType = "string"
+	FilterInt      FilterType = "int"
+	FilterFloat    FilterType = "float"
+	FilterBool     FilterType = "bool"
+	FilterTime     FilterType = "time"
+	FilterObjectID FilterType = "objectId"
+)
+
+// filterOperators maps operators to their Mongo equivalent.
+var filterOperators = map[FilterOperator]string{
+	FilterEq:    "$eq",
+	FilterNe:    "$ne",
+	FilterLt:    "$lt",
+	FilterLte:   "$lte",
+	FilterGt:    "$gt",
+	FilterGte:   "$gte",
+	FilterIn:    "$in",
+	FilterNotIn: "$nin",
+}
+
+// orderedFilterTypes are the types that can be compared with lt, gt and the like.
+var orderedFilterTypes = map[FilterType]bool{
+	FilterInt:      true,
+	FilterFloat:    true,
+	FilterTime:     true,
+	FilterObjectID: true,
+}
+
+// reservedQueryParams are left alone by the filter, they are used for
+// sorting, pagination and picking the format of the response.
+var reservedQueryParams = map[string]bool{
+	FormatQueryParam: true,
+	"sort":           true,
+	"page":           true,
+	"limit":          true,
+	"offset":         true,
+	"cursor":         true,
+}
+
+// allows reports whether the field may be filtered with op. Fields without
+// Operators allow every operator that makes sense for their type.
+func (f FilterField) allows(op FilterOperator) bool {
+	if len(f.Operators) == 0 {
+		switch op {
+		case FilterLt, FilterLte, FilterGt, FilterGte:
+			return orderedFilterTypes[f.Type]
+		case FilterIn, FilterNotIn:
+			return f.Type != FilterBool
+		}
+		return true
+	}
+
+	for _, allowed := range f.Operators {
+		if allowed == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+// column returns the name of the field in Mongo.
+func (f FilterField) column(name string) string {
+	if f.Column != "" {
+		return f.Column
+	}
+
+	return name
+}
+
+// coerce converts a query value to the type of the field.
+func (f FilterField) coerce(value string) (interface{}, error) {
+	switch f.Type {
+	case FilterInt:
+		return strconv.ParseInt(value, 10, 64)
+	case FilterFloat:
+		return strconv.ParseFloat(value, 64)
+	case FilterBool:
+		return strconv.ParseBool(value)
+	case FilterTime:
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, nil
+		}
+		return time.Parse("2006-01-02", value)
+	case FilterObjectID:
+		return primitive.ObjectIDFromHex(value)
+	default:
+		return value, nil
+	}
+}
+
+// lookup finds the field and operator a query parameter is for.
+func (s FilterSchema) lookup(key string) (string, FilterField, FilterOperator, bool) {
+	if field, ok := s[key]; ok {
+		return key, field, FilterEq, true
+	}
+
+	if i := strings.LastIndex(key, "_"); i > 0 {
+		name, op := key[:i], FilterOperator(key[i+1:])
+		if field, ok := s[name]; ok && op != FilterEq {
+			if _, known := filterOperators[op]; known {
+				return name, field, op, true
+			}
+		}
+	}
+
+	return "", FilterField{}, "", false
+}
+
+// ParseFilter turns the query parameters into a Mongo filter. Only fields in
+// the schema may be filtered on, with the operators it allows, and values are
+// coerced to the type of their field, so the filter can not be used to inject
+// other Mongo operators. Conditions on the same field are combined. Unknown
+// parameters, other than those used for sorting and pagination, return
+// ErrorInvalidFilter.
+func ParseFilter(query url.Values, schema FilterSchema) (bson.D, error) {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		if !reservedQueryParams[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	conditions := map[string]bson.D{}
+	columns := []string{}
+	for _, key := range keys {
+		name, field, op, ok := schema.lookup(key)
+		if !ok || !field.allows(op) {
+			return nil, ErrorInvalidFilter
+		}
+
+		for _, raw := range query[key] {
+			var value interface{}
+			if op == FilterIn || op == FilterNotIn {
+				values := bson.A{}
+				for _, part := range strings.Split(raw, ",") {
+					coerced, err := field.coerce(part)
+					if err != nil {
+						return nil, ErrorInvalidFilter
+					}
+					values = append(values, coerced)
+				}
+				value = values
+			} else {
+				coerced, err := field.coerce(raw)
+				if err != nil {
+					return nil, ErrorInvalidFilter
+				}
+				value = coerced
+			}
+
+			column := field.column(name)
+			if _, ok := conditions[column]; !ok {
+				columns = append(columns, column)
+			}
+			conditions[column] = append(conditions[column], bson.E{Key: filterOperators[op], Value: value})
+		}
+	}
+
+	filter := bson.D{}
+	for _, column := range columns {
+		filter = append(filter, bson.E{Key: column, Value: conditions[column]})
+	}
+
+	return filter, nil
+}
+
+// ParseSort turns a sort parameter such as -createdAt,name into a Mongo sort,
+// a leading - sorting that field descending. Only fields marked Sortable in
+// the schema can be sorted on, others return ErrorInvalidSort.
+func ParseSort(value string, schema FilterSchema) (bson.D, error) {
+	sortBy := bson.D{}
+	if value == "" {
+		return sortBy, nil
+	}
+
+	for _, name := range strings.Split(value, ",") {
+		direction := 1
+		if strings.HasPrefix(name, "-") {
+			direction = -1
+			name = name[1:]
+		}
+
+		field, ok := schema[name]
+		if !ok || !field.Sortable {
+			return nil, ErrorInvalidSort
+		}
+		sortBy = append(sortBy, bson.E{Key: field.column(name), Value: direction})
+	}
+
+	return sortBy, nil
+}
+
+// ParseQuery parses both the filter and the sort of the request handled by c,
+// ready to be passed to Find on a collection from GetMongoCollection. Errors
+// should be answered with a 400.
+func ParseQuery(c *gin.Context, schema FilterSchema) (filter bson.D, sortBy bson.D, err error) {
+	query := c.Request.URL.Query()
+
+	filter, err = ParseFilter(query, schema)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sortBy, err = ParseSort(query.Get("sort"), schema)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return filter, sortBy, nil
+}
@@ -0,0 +1,58 @@
+package tyrgin
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/stretchr/testify/assert"
+)
+
+var testSubmissionSchema = FilterSchema{
+	"status":    {Type: FilterString, Operators: []FilterOperator{FilterEq, FilterIn}},
+	"due":       {Type: FilterTime, Sortable: true},
+	"grade":     {Type: FilterFloat},
+	"late":      {Type: FilterBool},
+	"createdAt": {Type: FilterTime, Column: "created_at", Sortable: true},
+}
+
+func TestParseFilter(t *testing.T) {
+	query, _ := url.ParseQuery("status=graded&due_lt=2026-10-01&due_gte=2026-09-01T00:00:00Z&grade_in=90,95.5&late=true&sort=-createdAt&page=2")
+
+	filter, err := ParseFilter(query, testSubmissionSchema)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "due", Value: bson.D{
+			{Key: "$gte", Value: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)},
+			{Key: "$lt", Value: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+		}},
+		{Key: "grade", Value: bson.D{{Key: "$in", Value: bson.A{90.0, 95.5}}}},
+		{Key: "late", Value: bson.D{{Key: "$eq", Value: true}}},
+		{Key: "status", Value: bson.D{{Key: "$eq", Value: "graded"}}},
+	}, filter)
+}
+
+func TestParseFilterRejects(t *testing.T) {
+	for _, raw := range []string{
+		"password=x",
+		"status_ne=graded",
+		"late_gt=true",
+		"grade=ninety",
+		"due_lt=yesterday",
+		"status[$ne]=graded",
+	} {
+		query, _ := url.ParseQuery(raw)
+		_, err := ParseFilter(query, testSubmissionSchema)
+		assert.Equal(t, ErrorInvalidFilter, err, raw)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	sortBy, err := ParseSort("-createdAt,due", testSubmissionSchema)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{{Key: "created_at", Value: -1}, {Key: "due", Value: 1}}, sortBy)
+
+	_, err = ParseSort("grade", testSubmissionSchema)
+	assert.Equal(t, ErrorInvalidSort, err)
+}
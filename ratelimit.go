@@ -0,0 +1,349 @@
+package tyrgin
+
+import (
+	ctx "context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
+)
+
+// mongoRateLimitRetries is how many times the MongoRateLimitStore retries a
+// token bucket update that lost a race with another replica.
+const mongoRateLimitRetries = 5
+
+// KeyByIP counts requests against the client IP of gin, which trusts the
+// X-Forwarded-For and X-Real-Ip headers unless the ForwardedByClientIP of the
+// engine is turned off. Only use it behind a proxy setting them, clients
+// reaching the service directly can send any IP there and pick their own key.
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByRemoteAddr counts requests against the IP of the connection, for a
+// service that is not behind a proxy.
+func KeyByRemoteAddr(c *gin.Context) string {
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		host = c.Request.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// KeyByJWTIdentity counts requests against the identity gin-jwt stored under
+// identityKey, falling back to the client IP for anonymous requests.
+func KeyByJWTIdentity(identityKey string) RateLimitKeyFunc {
+	return func(c *gin.Context) string {
+		identity, ok := c.Get(identityKey)
+		if !ok {
+			identity, ok = jwt.ExtractClaims(c)[identityKey]
+		}
+		if !ok || identity == nil {
+			return KeyByIP(c)
+		}
+
+		return fmt.Sprintf("jwt:%v", identity)
+	}
+}
+
+// KeyByAPIKey counts requests against the API key sent in header, falling
+// back to the client IP when the header is missing.
+func KeyByAPIKey(header string) RateLimitKeyFunc {
+	return func(c *gin.Context) string {
+		key := c.GetHeader(header)
+		if key == "" {
+			return KeyByIP(c)
+		}
+
+		return "key:" + key
+	}
+}
+
+// takeToken refills a token bucket holding tokens at last up to now and
+// tries to take a single token from it.
+func takeToken(limit RateLimit, tokens float64, last, now time.Time) (float64, RateLimitResult) {
+	capacity := float64(limit.Limit)
+	rate := capacity / limit.Window.Seconds()
+
+	if !last.IsZero() {
+		tokens = math.Min(capacity, tokens+now.Sub(last).Seconds()*rate)
+	}
+
+	result := RateLimitResult{Limit: limit.Limit}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+
+	result.Remaining = int(tokens)
+	result.Reset = time.Duration((capacity - tokens) / rate * float64(time.Second))
+
+	return tokens, result
+}
+
+// slidingWindow estimates the requests made in the last window from the count
+// of the current and previous fixed windows, where count includes the request
+// being checked.
+func slidingWindow(limit RateLimit, previous, count int, windowStart, now time.Time) RateLimitResult {
+	elapsed := float64(now.Sub(windowStart)) / float64(limit.Window)
+	estimate := float64(previous)*(1-elapsed) + float64(count)
+	windowEnd := windowStart.Add(limit.Window)
+
+	result := RateLimitResult{
+		Allowed: estimate <= float64(limit.Limit),
+		Limit:   limit.Limit,
+		Reset:   windowEnd.Sub(now),
+	}
+
+	if result.Allowed {
+		result.Remaining = limit.Limit - int(math.Ceil(estimate))
+		return result
+	}
+
+	// Find when enough of the previous window has slid out to fit the request.
+	result.RetryAfter = windowEnd.Sub(now)
+	if count <= limit.Limit && previous > 0 {
+		needed := 1 - float64(limit.Limit-count)/float64(previous)
+		result.RetryAfter = time.Duration((needed - elapsed) * float64(limit.Window))
+	}
+
+	return result
+}
+
+// NewMemoryRateLimitStore returns an empty MemoryRateLimitStore.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*rateLimitBucket)}
+}
+
+// Take counts a request for key.
+func (m *MemoryRateLimitStore) Take(key string, limit RateLimit) (RateLimitResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+
+	bucket, ok := m.buckets[key]
+	if !ok {
+		bucket = &rateLimitBucket{tokens: float64(limit.Limit)}
+		m.buckets[key] = bucket
+	}
+	bucket.window = limit.Window
+
+	if limit.Algorithm == SlidingWindow {
+		windowStart := now.Truncate(limit.Window)
+		if !windowStart.Equal(bucket.windowStart) {
+			bucket.previous = 0
+			if windowStart.Sub(bucket.windowStart) == limit.Window {
+				bucket.previous = bucket.count
+			}
+			bucket.count = 0
+			bucket.windowStart = windowStart
+		}
+
+		result := slidingWindow(limit, bucket.previous, bucket.count+1, windowStart, now)
+		if result.Allowed {
+			bucket.count++
+		}
+		bucket.last = now
+
+		return result, nil
+	}
+
+	var result RateLimitResult
+	bucket.tokens, result = takeToken(limit, bucket.tokens, bucket.last, now)
+	bucket.last = now
+
+	return result, nil
+}
+
+// sweep occasionally drops buckets that have been idle long enough to be full
+// again so the store does not grow without bound. Routes sharing the store
+// may have different windows, so each bucket is swept by its own.
+func (m *MemoryRateLimitStore) sweep(now time.Time) {
+	m.takes++
+	if m.takes%1000 != 0 {
+		return
+	}
+
+	for key, bucket := range m.buckets {
+		if now.Sub(bucket.last) > 2*bucket.window {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// NewMongoRateLimitStore returns a MongoRateLimitStore using the named collection,
+// creating the TTL index that expires old counters.
+func NewMongoRateLimitStore(db *mongo.Database, collection string) (*MongoRateLimitStore, error) {
+	coll := GetMongoCollection(collection, db)
+	if err := EnsureTTLIndex(coll, "expireAt"); err != nil {
+		return nil, err
+	}
+
+	return &MongoRateLimitStore{Collection: coll}, nil
+}
+
+// Take counts a request for key.
+func (m *MongoRateLimitStore) Take(key string, limit RateLimit) (RateLimitResult, error) {
+	if limit.Algorithm == SlidingWindow {
+		return m.takeSlidingWindow(key, limit)
+	}
+
+	return m.takeToken(key, limit)
+}
+
+// takeSlidingWindow atomically increments the counter of the current window,
+// undoing the increment when the request is rejected.
+func (m *MongoRateLimitStore) takeSlidingWindow(key string, limit RateLimit) (RateLimitResult, error) {
+	now := time.Now()
+	windowStart := now.Truncate(limit.Window)
+	id := fmt.Sprintf("%s|%d", key, windowStart.UnixNano())
+	previousID := fmt.Sprintf("%s|%d", key, windowStart.Add(-limit.Window).UnixNano())
+
+	var current rateLimitDocument
+	err := m.Collection.FindOneAndUpdate(
+		ctx.Background(),
+		bson.D{{Key: "_id", Value: id}},
+		bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "count", Value: 1}}},
+			{Key: "$setOnInsert", Value: bson.D{{Key: "expireAt", Value: windowStart.Add(2 * limit.Window)}}},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&current)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	var previous rateLimitDocument
+	err = m.Collection.FindOne(ctx.Background(), bson.D{{Key: "_id", Value: previousID}}).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return RateLimitResult{}, err
+	}
+
+	result := slidingWindow(limit, previous.Count, current.Count, windowStart, now)
+	if !result.Allowed {
+		_, err = m.Collection.UpdateOne(
+			ctx.Background(),
+			bson.D{{Key: "_id", Value: id}},
+			bson.D{{Key: "$inc", Value: bson.D{{Key: "count", Value: -1}}}},
+		)
+	}
+
+	return result, err
+}
+
+// takeToken reads the bucket for key and writes it back only if no other
+// replica changed it in the meantime, retrying when it did.
+func (m *MongoRateLimitStore) takeToken(key string, limit RateLimit) (RateLimitResult, error) {
+	for i := 0; i < mongoRateLimitRetries; i++ {
+		now := time.Now()
+
+		var doc rateLimitDocument
+		err := m.Collection.FindOne(ctx.Background(), bson.D{{Key: "_id", Value: key}}).Decode(&doc)
+		exists := err == nil
+		if err != nil && err != mongo.ErrNoDocuments {
+			return RateLimitResult{}, err
+		}
+
+		var last time.Time
+		if exists {
+			last = time.Unix(0, doc.Last)
+		} else {
+			doc = rateLimitDocument{ID: key, Tokens: float64(limit.Limit)}
+		}
+
+		previousLast := doc.Last
+		var result RateLimitResult
+		doc.Tokens, result = takeToken(limit, doc.Tokens, last, now)
+		doc.Last = now.UnixNano()
+		doc.ExpireAt = now.Add(2 * limit.Window)
+
+		if !exists {
+			_, err = m.Collection.InsertOne(ctx.Background(), doc)
+			if isDuplicateKeyError(err) {
+				continue
+			}
+			return result, err
+		}
+
+		res, err := m.Collection.UpdateOne(
+			ctx.Background(),
+			bson.D{{Key: "_id", Value: key}, {Key: "last", Value: previousLast}},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "tokens", Value: doc.Tokens},
+				{Key: "last", Value: doc.Last},
+				{Key: "expireAt", Value: doc.ExpireAt},
+			}}},
+		)
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+		if res.MatchedCount == 1 {
+			return result, nil
+		}
+	}
+
+	return RateLimitResult{}, ErrorRateLimitContention
+}
+
+// setRateLimitHeaders writes the RateLimit-* headers for result.
+func setRateLimitHeaders(c *gin.Context, result RateLimitResult) {
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+}
+
+// RateLimiter returns a middleware enforcing limit. Requests over the limit are
+// rejected with a 429 and a Retry-After header. If the store fails the request
+// is let through and the error is logged, so an outage of a shared store does
+// not take the service down with it. It panics with ErrorInvalidRateLimit
+// unless the Limit and Window are positive.
+func RateLimiter(limit RateLimit) gin.HandlerFunc {
+	if limit.Limit <= 0 || limit.Window <= 0 {
+		panic(ErrorInvalidRateLimit)
+	}
+	if limit.Algorithm == "" {
+		limit.Algorithm = TokenBucket
+	}
+	if limit.KeyFunc == nil {
+		limit.KeyFunc = KeyByIP
+	}
+	if limit.Store == nil {
+		limit.Store = NewMemoryRateLimitStore()
+	}
+
+	return func(c *gin.Context) {
+		key := limit.Name + "|" + limit.KeyFunc(c)
+
+		result, err := limit.Store.Take(key, limit)
+		if err != nil {
+			ContextErrorLogger(c, err, fmt.Sprintf("Rate limit store failed for `%s`.", key))
+			c.Next()
+			return
+		}
+
+		setRateLimitHeaders(c, result)
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+			ErrorHandler(ErrorRateLimitExceeded, c, http.StatusTooManyRequests, gin.H{
+				"statusCode": http.StatusTooManyRequests,
+				"message":    ErrorRateLimitExceeded.Error(),
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,98 @@
+package tyrgin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func rateLimitActions(limit *RateLimit) []APIAction {
+	route := NewRoute(func(c *gin.Context) { c.Status(http.StatusOK) }, "limited", POST)
+	route.RateLimit = limit
+
+	return []APIAction{route}
+}
+
+func TestRateLimitTokenBucket(t *testing.T) {
+	router := newTestRouter(rateLimitActions(&RateLimit{Limit: 2, Window: time.Minute}))
+
+	resp := performRequest(router, "POST", "/api/v1/tester/limited", nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "2", resp.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", resp.Header().Get("RateLimit-Remaining"))
+
+	resp = performRequest(router, "POST", "/api/v1/tester/limited", nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "0", resp.Header().Get("RateLimit-Remaining"))
+
+	resp = performRequest(router, "POST", "/api/v1/tester/limited", nil)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "30", resp.Header().Get("Retry-After"))
+	assert.Equal(t, "application/json+error", resp.Header().Get("Content-Type"))
+}
+
+func TestRateLimitSlidingWindowByAPIKey(t *testing.T) {
+	router := newTestRouter(rateLimitActions(&RateLimit{
+		Limit:     1,
+		Window:    time.Hour,
+		Algorithm: SlidingWindow,
+		KeyFunc:   KeyByAPIKey("X-API-Key"),
+	}))
+
+	assert.Equal(t, http.StatusOK, performRequest(router, "POST", "/api/v1/tester/limited", nil, "X-API-Key", "alice").Code)
+	assert.Equal(t, http.StatusTooManyRequests, performRequest(router, "POST", "/api/v1/tester/limited", nil, "X-API-Key", "alice").Code)
+	assert.Equal(t, http.StatusOK, performRequest(router, "POST", "/api/v1/tester/limited", nil, "X-API-Key", "bob").Code)
+}
+
+func TestSlidingWindowEstimate(t *testing.T) {
+	limit := RateLimit{Limit: 10, Window: time.Minute}
+	windowStart := time.Now().Truncate(time.Minute)
+
+	// Half way through the window half of the previous 10 requests still count.
+	result := slidingWindow(limit, 10, 5, windowStart, windowStart.Add(30*time.Second))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	result = slidingWindow(limit, 10, 6, windowStart, windowStart.Add(30*time.Second))
+	assert.False(t, result.Allowed)
+	assert.InDelta(t, 6, result.RetryAfter.Seconds(), 0.001)
+}
+
+func TestMemoryRateLimitStoreSweepKeepsLongWindows(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	hourly := RateLimit{Limit: 1, Window: time.Hour, Algorithm: TokenBucket}
+	short := RateLimit{Limit: 1000, Window: time.Millisecond, Algorithm: TokenBucket}
+
+	result, err := store.Take("hourly", hourly)
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+
+	// Sweeping for the short window must not reset the hourly bucket.
+	time.Sleep(5 * time.Millisecond)
+	for i := 0; i < 1000; i++ {
+		store.Take("short", short)
+	}
+
+	result, err = store.Take("hourly", hourly)
+	assert.Nil(t, err)
+	assert.False(t, result.Allowed)
+}
+
+func TestRateLimiterInvalid(t *testing.T) {
+	assert.PanicsWithValue(t, ErrorInvalidRateLimit, func() { RateLimiter(RateLimit{Limit: 1}) })
+	assert.PanicsWithValue(t, ErrorInvalidRateLimit, func() { RateLimiter(RateLimit{Window: time.Minute}) })
+}
+
+func TestKeyByRemoteAddr(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Request.RemoteAddr = "10.0.0.1:4242"
+	c.Request.Header.Set("X-Forwarded-For", "1.2.3.4")
+
+	assert.Equal(t, "ip:1.2.3.4", KeyByIP(c))
+	assert.Equal(t, "ip:10.0.0.1", KeyByRemoteAddr(c))
+}
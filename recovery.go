@@ -0,0 +1,101 @@
+package tyrgin
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// panicCount is the number of panics Recovery has recovered from.
+var panicCount uint64
+
+// PanicCount returns how many panics have been recovered from since the
+// server started.
+func PanicCount() uint64 {
+	return atomic.LoadUint64(&panicCount)
+}
+
+// brokenConnection reports whether the panic was caused by the client going
+// away, in which case there is no one to send a response to.
+func brokenConnection(recovered interface{}) bool {
+	err, ok := recovered.(error)
+	if !ok {
+		return false
+	}
+
+	opErr, ok := err.(*net.OpError)
+	if !ok {
+		return false
+	}
+
+	if syscallErr, ok := opErr.Err.(*os.SyscallError); ok {
+		message := strings.ToLower(syscallErr.Error())
+		return strings.Contains(message, "broken pipe") || strings.Contains(message, "connection reset by peer")
+	}
+
+	return false
+}
+
+// Recovery returns a middleware recovering from panics in the handlers after
+// it. The panic value, stack trace and request are logged, the panic counter
+// shown by PanicStatusChecker is incremented and a JSON 500 is sent through
+// ErrorHandler unless a response was already started.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			atomic.AddUint64(&panicCount, 1)
+
+			ContextLogger(c).WithFields(log.Fields{
+				"panic":         fmt.Sprintf("%v", recovered),
+				"stack":         string(debug.Stack()),
+				"RequestMethod": c.Request.Method,
+				"RequestUrl":    contextRedactionPolicy(c).RedactURL(c.Request.URL),
+			}).Error("Panic Recovered")
+
+			if brokenConnection(recovered) || c.Writer.Written() {
+				c.Error(ErrorPanicRecovered)
+				c.Abort()
+				return
+			}
+
+			ErrorHandler(ErrorPanicRecovered, c, http.StatusInternalServerError, gin.H{
+				"statusCode": http.StatusInternalServerError,
+				"message":    ErrorPanicRecovered.Error(),
+			})
+		}()
+
+		c.Next()
+	}
+}
+
+// CheckStatus reports the number of panics recovered from, as a warning once
+// it reaches the Threshold of the checker.
+func (p PanicStatusChecker) CheckStatus(name string) StatusList {
+	count := PanicCount()
+	result := OK
+	if p.Threshold > 0 && count >= p.Threshold {
+		result = WARNING
+	}
+
+	return StatusList{
+		StatusList: []Status{
+			{
+				Description: name,
+				Result:      result,
+				Details:     fmt.Sprintf("%d panics recovered", count),
+			},
+		},
+	}
+}
@@ -0,0 +1,52 @@
+package tyrgin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecovery(t *testing.T) {
+	hook := test.NewGlobal()
+
+	router := gin.New()
+	router.Use(RequestID())
+	router.Use(Recovery())
+	router.GET("/panics", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	before := PanicCount()
+	resp := performRequest(router, "GET", "/panics?token=abc", nil)
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Equal(t, "application/json+error", resp.Header().Get("Content-Type"))
+	assert.Equal(t, before+1, PanicCount())
+
+	var body map[string]interface{}
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, float64(http.StatusInternalServerError), body["statusCode"])
+	assert.Equal(t, ErrorPanicRecovered.Error(), body["message"])
+
+	entry := hook.LastEntry()
+	assert.Equal(t, "Panic Recovered", entry.Message)
+	assert.Equal(t, "boom", entry.Data["panic"])
+	assert.Equal(t, "/panics?token="+RedactedValue, entry.Data["RequestUrl"])
+	assert.Contains(t, entry.Data["stack"], "recovery_test.go")
+	assert.Equal(t, resp.Header().Get(RequestIDHeader), entry.Data["requestId"])
+}
+
+func TestPanicStatusChecker(t *testing.T) {
+	status := PanicStatusChecker{}.CheckStatus("panics").StatusList[0]
+	assert.Equal(t, OK, status.Result)
+
+	status = PanicStatusChecker{Threshold: PanicCount() + 1}.CheckStatus("panics").StatusList[0]
+	assert.Equal(t, OK, status.Result)
+
+	panicCount++
+	status = PanicStatusChecker{Threshold: PanicCount()}.CheckStatus("panics").StatusList[0]
+	assert.Equal(t, WARNING, status.Result)
+}
@@ -0,0 +1,214 @@
+package tyrgin
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RedactedValue replaces whatever a RedactionPolicy hides.
+const RedactedValue = "[REDACTED]"
+
+// redactionPolicyKey is where Redact keeps the policy of a route.
+const redactionPolicyKey = "RedactionPolicy"
+
+var (
+	redactionMu     sync.RWMutex
+	redactionPolicy = DefaultRedactionPolicy()
+)
+
+// DefaultRedactionPolicy hides credentials and cookies in headers, emails,
+// passwords and tokens anywhere in bodies and anything that looks like a JWT
+// or an email address.
+func DefaultRedactionPolicy() *RedactionPolicy {
+	return &RedactionPolicy{
+		Headers: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"},
+		Paths: []string{
+			"**.email",
+			"**.password",
+			"**.passwordConfirmation",
+			"**.token",
+			"**.accessToken",
+			"**.refreshToken",
+			"**.secret",
+		},
+		Values: []*regexp.Regexp{
+			regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+			regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/-]+=*`),
+			regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		},
+	}
+}
+
+// CurrentRedactionPolicy returns the policy Logger uses for routes without
+// their own.
+func CurrentRedactionPolicy() *RedactionPolicy {
+	redactionMu.RLock()
+	defer redactionMu.RUnlock()
+
+	return redactionPolicy
+}
+
+// SetRedactionPolicy changes the policy Logger uses for routes without their
+// own, nil logs everything as it is.
+func SetRedactionPolicy(policy *RedactionPolicy) {
+	if policy == nil {
+		policy = &RedactionPolicy{}
+	}
+
+	redactionMu.Lock()
+	redactionPolicy = policy
+	redactionMu.Unlock()
+}
+
+// Redact a middleware making Logger use policy, instead of the current one,
+// for the requests it handles. APIAction.Redaction adds it to a route.
+func Redact(policy *RedactionPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(redactionPolicyKey, policy)
+		c.Next()
+	}
+}
+
+// contextRedactionPolicy returns the policy for the request handled by c.
+func contextRedactionPolicy(c *gin.Context) *RedactionPolicy {
+	if policy, ok := c.Get(redactionPolicyKey); ok {
+		return policy.(*RedactionPolicy)
+	}
+
+	return CurrentRedactionPolicy()
+}
+
+// RedactHeaders returns a copy of headers with the values of the denied
+// headers hidden and the value patterns masked in the rest.
+func (p *RedactionPolicy) RedactHeaders(headers http.Header) http.Header {
+	redacted := make(http.Header, len(headers))
+	for name, values := range headers {
+		denied := false
+		for _, header := range p.Headers {
+			if strings.EqualFold(header, name) {
+				denied = true
+				break
+			}
+		}
+
+		copied := make([]string, len(values))
+		for i, value := range values {
+			if denied {
+				copied[i] = RedactedValue
+			} else {
+				copied[i] = p.RedactString(value)
+			}
+		}
+		redacted[name] = copied
+	}
+
+	return redacted
+}
+
+// RedactString masks whatever matches the value patterns in s.
+func (p *RedactionPolicy) RedactString(s string) string {
+	for _, pattern := range p.Values {
+		s = pattern.ReplaceAllString(s, RedactedValue)
+	}
+
+	return s
+}
+
+// RedactURL returns u with the values of the query parameters named by the
+// paths of the policy hidden, as if the query were a JSON object, and the
+// value patterns masked in the rest.
+func (p *RedactionPolicy) RedactURL(u *url.URL) string {
+	redacted := *u
+	if u.RawQuery != "" {
+		patterns := p.pathPatterns()
+		params := strings.Split(u.RawQuery, "&")
+		for i, param := range params {
+			parts := strings.SplitN(param, "=", 2)
+			if len(parts) < 2 {
+				continue
+			}
+			key, err := url.QueryUnescape(parts[0])
+			if err != nil {
+				key = parts[0]
+			}
+
+			for _, pattern := range patterns {
+				if matchRedactionPath(pattern, []string{key}) {
+					params[i] = parts[0] + "=" + RedactedValue
+					break
+				}
+			}
+		}
+		redacted.RawQuery = strings.Join(params, "&")
+	}
+
+	return p.RedactString(redacted.String())
+}
+
+// RedactJSON hides the values at the paths of the policy in decoded JSON and
+// masks the value patterns in the strings left, changing value in place.
+func (p *RedactionPolicy) RedactJSON(value interface{}) interface{} {
+	return p.redactValue(value, []string{}, p.pathPatterns())
+}
+
+// pathPatterns returns the paths of the policy split into keys.
+func (p *RedactionPolicy) pathPatterns() [][]string {
+	patterns := make([][]string, len(p.Paths))
+	for i, path := range p.Paths {
+		patterns[i] = strings.Split(path, ".")
+	}
+
+	return patterns
+}
+
+// redactValue redacts value found at path.
+func (p *RedactionPolicy) redactValue(value interface{}, path []string, patterns [][]string) interface{} {
+	for _, pattern := range patterns {
+		if len(path) > 0 && matchRedactionPath(pattern, path) {
+			return RedactedValue
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = p.redactValue(child, append(path, key), patterns)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = p.redactValue(child, append(path, "*"), patterns)
+		}
+	case string:
+		return p.RedactString(v)
+	}
+
+	return value
+}
+
+// matchRedactionPath reports whether path matches pattern, where * stands for
+// any single key or array element and ** for any number of them. Keys match
+// regardless of case.
+func matchRedactionPath(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+
+	switch pattern[0] {
+	case "**":
+		for skip := 0; skip <= len(path); skip++ {
+			if matchRedactionPath(pattern[1:], path[skip:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(path) > 0 && matchRedactionPath(pattern[1:], path[1:])
+	}
+
+	return len(path) > 0 && strings.EqualFold(pattern[0], path[0]) && matchRedactionPath(pattern[1:], path[1:])
+}
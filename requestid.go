@@ -0,0 +1,116 @@
+package tyrgin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request ID header and the gin context key it is stored under.
+const (
+	RequestIDHeader = "X-Request-ID"
+	RequestIDKey    = "RequestID"
+)
+
+// requestIDContextKey is the key the request ID is stored under in the
+// context.Context of the *http.Request.
+type requestIDContextKey struct{}
+
+// validRequestID limits what inbound request IDs are trusted, anything else is
+// replaced so clients can not inject arbitrary text into the logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// newRequestID returns a random 128 bit hex request ID.
+func newRequestID() string {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	ErrorLogger(err, "Failed to generate request id.")
+
+	return hex.EncodeToString(id)
+}
+
+// RequestID returns a middleware that accepts the X-Request-ID header of the
+// request, or generates one, stores it in the gin context and in the context
+// of the request, and echoes it in the response. It should be the first
+// middleware installed so every log entry for the request carries the ID.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		c.Set(RequestIDKey, id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDContextKey{}, id))
+		c.Header(RequestIDHeader, id)
+
+		c.Next()
+	}
+}
+
+// GetRequestID returns the request ID of the request, or an empty string
+// when the RequestID middleware is not installed.
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(RequestIDKey)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, which may be
+// either a *gin.Context or the context of a request.
+func RequestIDFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDContextKey{}).(string); ok {
+		return id
+	}
+
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
+
+// RequestIDTransport is a http.RoundTripper that forwards the request ID found
+// in the context of outbound requests as the X-Request-ID header.
+type RequestIDTransport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	id := RequestIDFromContext(req.Context())
+	if id == "" || req.Header.Get(RequestIDHeader) != "" {
+		return base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the request it was given.
+	outbound := req.WithContext(req.Context())
+	outbound.Header = make(http.Header, len(req.Header)+1)
+	for key, values := range req.Header {
+		outbound.Header[key] = values
+	}
+	outbound.Header.Set(RequestIDHeader, id)
+
+	return base.RoundTrip(outbound)
+}
+
+// NewOutboundRequest creates a request to another service that carries the
+// context and request ID of the request being handled by c.
+func NewOutboundRequest(c *gin.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(c.Request.Context())
+	if id := GetRequestID(c); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+
+	return req, nil
+}
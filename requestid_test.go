@@ -0,0 +1,64 @@
+package tyrgin
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	router := gin.New()
+	router.Use(RequestID())
+	router.GET("/id", func(c *gin.Context) {
+		c.String(http.StatusOK, GetRequestID(c))
+	})
+
+	resp := performRequest(router, "GET", "/id", nil, RequestIDHeader, "abc-123")
+	assert.Equal(t, "abc-123", resp.Header().Get(RequestIDHeader))
+	assert.Equal(t, "abc-123", resp.Body.String())
+
+	resp = performRequest(router, "GET", "/id", nil)
+	assert.Len(t, resp.Header().Get(RequestIDHeader), 32)
+	assert.Equal(t, resp.Header().Get(RequestIDHeader), resp.Body.String())
+
+	resp = performRequest(router, "GET", "/id", nil, RequestIDHeader, "bad id\nwith newline")
+	assert.Len(t, resp.Header().Get(RequestIDHeader), 32)
+}
+
+func TestRequestIDLoggedAndForwarded(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get(RequestIDHeader)))
+	}))
+	defer downstream.Close()
+
+	client := &http.Client{Transport: &RequestIDTransport{}}
+	hook := test.NewGlobal()
+
+	router := gin.New()
+	router.Use(RequestID())
+	router.Use(Logger())
+	router.GET("/id", func(c *gin.Context) {
+		req, _ := http.NewRequest("GET", downstream.URL, nil)
+		resp, err := client.Do(req.WithContext(c.Request.Context()))
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		ContextNormalLog(c, "called downstream")
+		c.String(http.StatusOK, string(body))
+	})
+
+	resp := performRequest(router, "GET", "/id", nil, RequestIDHeader, "forward-me")
+	assert.Equal(t, "forward-me", resp.Body.String())
+
+	entries := hook.AllEntries()
+	assert.True(t, len(entries) >= 2)
+	for _, entry := range entries[len(entries)-2:] {
+		assert.Equal(t, "forward-me", entry.Data["requestId"])
+	}
+}
@@ -0,0 +1,589 @@
+package tyrgin
+
+import (
+	"bytes"
+	ctx "context"
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/bsoncodec"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
+)
+
+// The actions Resource can generate.
+const (
+	ResourceList    ResourceAction = "list"
+	ResourceGet     ResourceAction = "get"
+	ResourceCreate  ResourceAction = "create"
+	ResourceReplace ResourceAction = "replace"
+	ResourcePatch   ResourceAction = "patch"
+	ResourceDelete  ResourceAction = "delete"
+)
+
+var allResourceActions = []ResourceAction{
+	ResourceList,
+	ResourceGet,
+	ResourceCreate,
+	ResourceReplace,
+	ResourcePatch,
+	ResourceDelete,
+}
+
+// resourceError sends err with the given status. Server errors come from
+// stores and drivers, so only their status text is sent and err is logged.
+func resourceError(c *gin.Context, err error, status int) {
+	message := err.Error()
+	if status >= http.StatusInternalServerError {
+		ContextErrorLogger(c, err, "Request failed with a server error.")
+		message = http.StatusText(status)
+	}
+
+	ErrorHandler(err, c, status, gin.H{
+		"statusCode": status,
+		"message":    message,
+	})
+}
+
+// new returns a pointer to a new value of the type of the resource.
+func (r *resource) new() interface{} {
+	return reflect.New(r.model).Interface()
+}
+
+// Find returns the documents matching filter, sorted, skipped and limited.
+func (m *MongoResourceStore) Find(filter, sort bson.D, skip, limit int64, projection bson.D) ([]bson.Raw, error) {
+	opts := options.Find().SetSkip(skip).SetLimit(limit).SetProjection(projection)
+	if len(sort) > 0 {
+		opts.SetSort(sort)
+	}
+
+	cursor, err := m.Collection.Find(ctx.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx.Background())
+
+	docs := []bson.Raw{}
+	for cursor.Next(ctx.Background()) {
+		raw, err := cursor.DecodeBytes()
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, raw)
+	}
+
+	return docs, cursor.Err()
+}
+
+// Count returns the number of documents matching filter.
+func (m *MongoResourceStore) Count(filter bson.D) (int64, error) {
+	return m.Collection.CountDocuments(ctx.Background(), filter)
+}
+
+// Get returns the document with the given id.
+func (m *MongoResourceStore) Get(id primitive.ObjectID, projection bson.D) (bson.Raw, error) {
+	raw, err := m.Collection.FindOne(
+		ctx.Background(),
+		bson.D{{Key: "_id", Value: id}},
+		options.FindOne().SetProjection(projection),
+	).DecodeBytes()
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrorResourceNotFound
+	}
+
+	return raw, err
+}
+
+// Insert stores a new document.
+func (m *MongoResourceStore) Insert(doc bson.D) error {
+	_, err := m.Collection.InsertOne(ctx.Background(), doc)
+	return err
+}
+
+// Replace stores doc in place of the document with the given id.
+func (m *MongoResourceStore) Replace(id primitive.ObjectID, doc bson.D) error {
+	result, err := m.Collection.ReplaceOne(ctx.Background(), bson.D{{Key: "_id", Value: id}}, doc)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrorResourceNotFound
+	}
+
+	return nil
+}
+
+// Update sets and unsets fields of the document with the given id.
+func (m *MongoResourceStore) Update(id primitive.ObjectID, set bson.D, unset []string) error {
+	update := bson.D{}
+	if len(set) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: set})
+	}
+	if len(unset) > 0 {
+		fields := bson.D{}
+		for _, key := range unset {
+			fields = append(fields, bson.E{Key: key, Value: ""})
+		}
+		update = append(update, bson.E{Key: "$unset", Value: fields})
+	}
+	if len(update) == 0 {
+		_, err := m.Get(id, bson.D{{Key: "_id", Value: 1}})
+		return err
+	}
+
+	result, err := m.Collection.UpdateOne(ctx.Background(), bson.D{{Key: "_id", Value: id}}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrorResourceNotFound
+	}
+
+	return nil
+}
+
+// Delete removes the document with the given id.
+func (m *MongoResourceStore) Delete(id primitive.ObjectID) error {
+	result, err := m.Collection.DeleteOne(ctx.Background(), bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrorResourceNotFound
+	}
+
+	return nil
+}
+
+// store returns where the documents of the resource are kept.
+func (r *resource) store() ResourceStore {
+	if r.config.Store != nil {
+		return r.config.Store
+	}
+
+	return &MongoResourceStore{Collection: GetMongoCollection(r.name, r.db)}
+}
+
+// storeError sends the error of a store, a 404 when the document was not found.
+func storeError(c *gin.Context, err error) {
+	if err == ErrorResourceNotFound {
+		resourceError(c, err, http.StatusNotFound)
+		return
+	}
+
+	resourceError(c, err, http.StatusInternalServerError)
+}
+
+// projection returns the projection for reads made by c.
+func (r *resource) projection(c *gin.Context) bson.D {
+	if r.config.Projection == nil {
+		return nil
+	}
+
+	return r.config.Projection(c)
+}
+
+// authorize runs the Authorize hook, sending a 403 when it fails.
+func (r *resource) authorize(c *gin.Context, action ResourceAction, id string) bool {
+	if r.config.Authorize == nil {
+		return true
+	}
+
+	if err := r.config.Authorize(c, action, id); err != nil {
+		resourceError(c, err, http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// validate runs the Validate hook, sending a 400 when it fails.
+func (r *resource) validate(c *gin.Context, doc interface{}) bool {
+	if r.config.Validate == nil {
+		return true
+	}
+
+	if err := r.config.Validate(c, doc); err != nil {
+		resourceError(c, err, http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// id returns the _id in the route, sending a 404 when it is not one.
+func (r *resource) id(c *gin.Context) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		resourceError(c, ErrorResourceNotFound, http.StatusNotFound)
+		return id, false
+	}
+
+	return id, true
+}
+
+// document turns doc into a bson.D without its _id, so clients can not
+// choose or change it.
+func document(doc interface{}) (bson.D, error) {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields bson.D
+	if err := bson.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	withoutID := bson.D{}
+	for _, field := range fields {
+		if field.Key != "_id" {
+			withoutID = append(withoutID, field)
+		}
+	}
+
+	return withoutID, nil
+}
+
+// modelFields returns the keys documents of a model type are stored under.
+func modelFields(model reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := 0; i < model.NumField(); i++ {
+		field := model.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tags, err := bsoncodec.DefaultStructTagParser(field)
+		if err != nil || tags.Skip {
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if tags.Inline && fieldType.Kind() == reflect.Struct {
+			for key := range modelFields(fieldType) {
+				fields[key] = true
+			}
+			continue
+		}
+		fields[tags.Name] = true
+	}
+
+	return fields
+}
+
+// changes returns the fields of doc that differ from current, and the
+// declared fields current has that doc dropped for being empty, so a patch
+// only writes what it changed. Fields the model does not declare, written by
+// someone else, are left alone.
+func changes(current bson.Raw, doc bson.D, declared map[string]bool) (bson.D, []string, error) {
+	var fields bson.D
+	if err := bson.Unmarshal(current, &fields); err != nil {
+		return nil, nil, err
+	}
+
+	existing := map[string][]byte{}
+	for _, field := range fields {
+		encoded, err := bson.Marshal(bson.D{field})
+		if err != nil {
+			return nil, nil, err
+		}
+		existing[field.Key] = encoded
+	}
+
+	set := bson.D{}
+	kept := map[string]bool{}
+	for _, field := range doc {
+		kept[field.Key] = true
+		encoded, err := bson.Marshal(bson.D{field})
+		if err != nil {
+			return nil, nil, err
+		}
+		if !bytes.Equal(encoded, existing[field.Key]) {
+			set = append(set, field)
+		}
+	}
+
+	unset := []string{}
+	for _, field := range fields {
+		if field.Key != "_id" && declared[field.Key] && !kept[field.Key] {
+			unset = append(unset, field.Key)
+		}
+	}
+
+	return set, unset, nil
+}
+
+// respondWith sends the stored document with the given id, as projected for c.
+func (r *resource) respondWith(c *gin.Context, id primitive.ObjectID, status int) {
+	raw, err := r.store().Get(id, r.projection(c))
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+
+	doc := r.new()
+	if err := bson.Unmarshal(raw, doc); err != nil {
+		resourceError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(status, doc)
+}
+
+// list pages through the resource, filtered and sorted by the query.
+func (r *resource) list(c *gin.Context) {
+	if !r.authorize(c, ResourceList, "") {
+		return
+	}
+
+	p, err := ParsePagination(c, r.config.Pagination)
+	if err != nil {
+		resourceError(c, err, http.StatusBadRequest)
+		return
+	}
+	// Cursors follow _id, so cursor pages can not be sorted otherwise.
+	cursorPages := p.Cursor != "" || r.config.CursorPagination
+	filter, sortBy, err := ParseQuery(c, r.config.Schema)
+	if err == nil && cursorPages && len(sortBy) > 0 {
+		err = ErrorInvalidSort
+	}
+	if err != nil {
+		resourceError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	if cursorPages {
+		sortBy = bson.D{{Key: "_id", Value: 1}}
+	}
+
+	store := r.store()
+	docs, err := store.Find(p.Filter(filter), sortBy, p.Offset, p.Limit, r.projection(c))
+	if err != nil {
+		resourceError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	items := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(r.model)), 0, len(docs))
+	var lastID primitive.ObjectID
+	for _, raw := range docs {
+		item := r.new()
+		if err := bson.Unmarshal(raw, item); err != nil {
+			resourceError(c, err, http.StatusInternalServerError)
+			return
+		}
+		lastID, _ = raw.Lookup("_id").ObjectIDOK()
+		items = reflect.Append(items, reflect.ValueOf(item))
+	}
+
+	if cursorPages {
+		nextCursor := ""
+		if int64(items.Len()) == p.Limit && !lastID.IsZero() {
+			nextCursor = NextCursor(lastID)
+		}
+		WritePage(c, p, items.Interface(), -1, nextCursor)
+		return
+	}
+
+	total, err := store.Count(filter)
+	if err != nil {
+		resourceError(c, err, http.StatusInternalServerError)
+		return
+	}
+	WritePage(c, p, items.Interface(), total, "")
+}
+
+// get sends one document of the resource.
+func (r *resource) get(c *gin.Context) {
+	if !r.authorize(c, ResourceGet, c.Param("id")) {
+		return
+	}
+	id, ok := r.id(c)
+	if !ok {
+		return
+	}
+
+	r.respondWith(c, id, http.StatusOK)
+}
+
+// create stores a new document from the body.
+func (r *resource) create(c *gin.Context) {
+	if !r.authorize(c, ResourceCreate, "") {
+		return
+	}
+
+	doc := r.new()
+	if err := c.ShouldBindJSON(doc); err != nil {
+		resourceError(c, err, http.StatusBadRequest)
+		return
+	}
+	if !r.validate(c, doc) {
+		return
+	}
+
+	fields, err := document(doc)
+	if err != nil {
+		resourceError(c, err, http.StatusBadRequest)
+		return
+	}
+	id := primitive.NewObjectID()
+	if err := r.store().Insert(append(bson.D{{Key: "_id", Value: id}}, fields...)); err != nil {
+		resourceError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Location", path.Join(c.Request.URL.Path, id.Hex()))
+	r.respondWith(c, id, http.StatusCreated)
+}
+
+// replace stores the body in place of a document.
+func (r *resource) replace(c *gin.Context) {
+	if !r.authorize(c, ResourceReplace, c.Param("id")) {
+		return
+	}
+	id, ok := r.id(c)
+	if !ok {
+		return
+	}
+
+	doc := r.new()
+	if err := c.ShouldBindJSON(doc); err != nil {
+		resourceError(c, err, http.StatusBadRequest)
+		return
+	}
+	if !r.validate(c, doc) {
+		return
+	}
+
+	r.save(c, id, doc)
+}
+
+// patch merges the fields in the body into a document. The merged document
+// is validated as a whole, but only the fields the patch changed are stored
+// so concurrent patches of other fields are not lost.
+func (r *resource) patch(c *gin.Context) {
+	if !r.authorize(c, ResourcePatch, c.Param("id")) {
+		return
+	}
+	id, ok := r.id(c)
+	if !ok {
+		return
+	}
+
+	raw, err := r.store().Get(id, nil)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+	doc := r.new()
+	if err := bson.Unmarshal(raw, doc); err != nil {
+		resourceError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewDecoder(c.Request.Body).Decode(doc); err != nil {
+		resourceError(c, err, http.StatusBadRequest)
+		return
+	}
+	if !r.validate(c, doc) {
+		return
+	}
+
+	fields, err := document(doc)
+	if err != nil {
+		resourceError(c, err, http.StatusBadRequest)
+		return
+	}
+	set, unset, err := changes(raw, fields, modelFields(r.model))
+	if err != nil {
+		resourceError(c, err, http.StatusInternalServerError)
+		return
+	}
+	if err := r.store().Update(id, set, unset); err != nil {
+		storeError(c, err)
+		return
+	}
+
+	r.respondWith(c, id, http.StatusOK)
+}
+
+// save replaces the document with the given id by doc.
+func (r *resource) save(c *gin.Context, id primitive.ObjectID, doc interface{}) {
+	fields, err := document(doc)
+	if err != nil {
+		resourceError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := r.store().Replace(id, fields); err != nil {
+		storeError(c, err)
+		return
+	}
+
+	r.respondWith(c, id, http.StatusOK)
+}
+
+// remove deletes a document.
+func (r *resource) remove(c *gin.Context) {
+	if !r.authorize(c, ResourceDelete, c.Param("id")) {
+		return
+	}
+	id, ok := r.id(c)
+	if !ok {
+		return
+	}
+
+	if err := r.store().Delete(id); err != nil {
+		storeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Resource returns the APIActions of a CRUD resource over the collection
+// called name, storing documents of the type of model. They are meant to be
+// given to AddRoutes with the name of the resource as the api, so the list
+// and create actions are at its root and the others at /:id. The config
+// chooses the actions and adds hooks for validation, authorization and
+// projection. The APIActions can be changed before they are added, to rate
+// limit them for example.
+func Resource(db *mongo.Database, name string, model interface{}, config ResourceConfig) []APIAction {
+	modelType := reflect.TypeOf(model)
+	if modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+	r := &resource{db: db, name: name, model: modelType, config: config}
+
+	actions := config.Actions
+	if len(actions) == 0 {
+		actions = allResourceActions
+	}
+
+	routes := []APIAction{}
+	for _, action := range actions {
+		switch action {
+		case ResourceList:
+			routes = append(routes, NewRoute(r.list, "", GET))
+		case ResourceGet:
+			routes = append(routes, NewRoute(r.get, ":id", GET))
+		case ResourceCreate:
+			routes = append(routes, NewRoute(r.create, "", POST))
+		case ResourceReplace:
+			routes = append(routes, NewRoute(r.replace, ":id", PUT))
+		case ResourcePatch:
+			routes = append(routes, NewRoute(r.patch, ":id", PATCH))
+		case ResourceDelete:
+			routes = append(routes, NewRoute(r.remove, ":id", DELETE))
+		}
+	}
+
+	return routes
+}
@@ -0,0 +1,129 @@
+package tyrgin
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSubmission struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Status string             `json:"status" bson:"status"`
+	Grade  float64            `json:"grade" bson:"grade"`
+}
+
+func TestResourceActions(t *testing.T) {
+	actions := Resource(nil, "submissions", &testSubmission{}, ResourceConfig{})
+	routes := []string{}
+	for _, action := range actions {
+		routes = append(routes, string(action.Method)+" "+action.Route)
+	}
+	assert.Equal(t, []string{"GET ", "GET :id", "POST ", "PUT :id", "PATCH :id", "DELETE :id"}, routes)
+
+	actions = Resource(nil, "submissions", testSubmission{}, ResourceConfig{Actions: []ResourceAction{ResourceList, ResourceGet}})
+	assert.Equal(t, 2, len(actions))
+}
+
+func TestResourceHooks(t *testing.T) {
+	errorForbidden := errors.New("FORBIDDEN")
+	validated := 0
+	config := ResourceConfig{
+		Authorize: func(c *gin.Context, action ResourceAction, id string) error {
+			if action == ResourceDelete {
+				return errorForbidden
+			}
+			return nil
+		},
+		Validate: func(c *gin.Context, doc interface{}) error {
+			validated++
+			if doc.(*testSubmission).Grade > 100 {
+				return errors.New("GRADE TOO HIGH")
+			}
+			return nil
+		},
+		Schema: FilterSchema{"status": {Type: FilterString}},
+	}
+
+	router := gin.New()
+	AddRoutes(router, false, nil, "1", "submissions", Resource(nil, "submissions", testSubmission{}, config))
+
+	id := primitive.NewObjectID().Hex()
+	resp := performRequest(router, "DELETE", "/api/v1/submissions/"+id, nil)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	resp = performRequest(router, "POST", "/api/v1/submissions", []byte(`{"status":"graded","grade":101}`))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, 1, validated)
+
+	resp = performRequest(router, "GET", "/api/v1/submissions/not-an-id", nil)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = performRequest(router, "GET", "/api/v1/submissions?password=x", nil)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestResourceDocument(t *testing.T) {
+	doc, err := document(&testSubmission{ID: primitive.NewObjectID(), Status: "graded", Grade: 90})
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{{Key: "status", Value: "graded"}, {Key: "grade", Value: 90.0}}, doc)
+}
+
+func TestResourceChanges(t *testing.T) {
+	current, err := bson.Marshal(bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "status", Value: "submitted"},
+		{Key: "grade", Value: 90.0},
+		{Key: "comment", Value: "late"},
+		{Key: "legacy", Value: true},
+	})
+	assert.Nil(t, err)
+
+	declared := map[string]bool{"_id": true, "status": true, "grade": true, "comment": true}
+	set, unset, err := changes(current, bson.D{{Key: "status", Value: "graded"}, {Key: "grade", Value: 90.0}}, declared)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{{Key: "status", Value: "graded"}}, set)
+	// Fields the model does not declare are someone else's and kept.
+	assert.Equal(t, []string{"comment"}, unset)
+}
+
+func TestModelFields(t *testing.T) {
+	type Base struct {
+		Created string `bson:"created"`
+	}
+	type model struct {
+		Base    `bson:",inline"`
+		ID      primitive.ObjectID `bson:"_id,omitempty"`
+		Comment string             `bson:"comment,omitempty"`
+		Late    bool
+		Notes   string `bson:"-"`
+		hidden  string
+	}
+
+	assert.Equal(t, map[string]bool{"created": true, "_id": true, "comment": true, "late": true}, modelFields(reflect.TypeOf(model{})))
+}
+
+// failingResourceStore fails every call like an unreachable database.
+type failingResourceStore struct {
+	ResourceStore
+}
+
+func (failingResourceStore) Find(filter, sort bson.D, skip, limit int64, projection bson.D) ([]bson.Raw, error) {
+	return nil, errors.New("server selection timeout: mongo-0.internal:27017")
+}
+
+func TestResourceServerErrorHidden(t *testing.T) {
+	router := gin.New()
+	config := ResourceConfig{Store: failingResourceStore{}}
+	AddRoutes(router, false, nil, "1", "submissions", Resource(nil, "submissions", testSubmission{}, config))
+
+	resp := performRequest(router, "GET", "/api/v1/submissions", nil)
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.NotContains(t, resp.Body.String(), "mongo-0.internal")
+	assert.Contains(t, resp.Body.String(), http.StatusText(http.StatusInternalServerError))
+}
@@ -0,0 +1,307 @@
+package tyrgin
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// rotatedTimeFormat is the timestamp added to the name of rotated files.
+const rotatedTimeFormat = "20060102T150405.000"
+
+// rotateRetryInterval is how long a file that could not be rotated is
+// written to before rotating it is tried again.
+const rotateRetryInterval = time.Minute
+
+var reopenOnHangup sync.Once
+
+// LogRotationFromEnv reads how file sinks are rotated from
+// LOG_ROTATE_MAX_SIZE_MB, LOG_ROTATE_INTERVAL, LOG_ROTATE_MAX_BACKUPS,
+// LOG_ROTATE_MAX_AGE and LOG_ROTATE_COMPRESS. Files are not rotated when
+// neither a size nor an interval is set.
+func LogRotationFromEnv() (LogRotation, error) {
+	rotation := LogRotation{}
+
+	if size := os.Getenv("LOG_ROTATE_MAX_SIZE_MB"); size != "" {
+		megabytes, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || megabytes < 0 {
+			return LogRotation{}, ErrorInvalidLogRotation
+		}
+		rotation.MaxSize = megabytes << 20
+	}
+
+	for key, target := range map[string]*time.Duration{
+		"LOG_ROTATE_INTERVAL": &rotation.Interval,
+		"LOG_ROTATE_MAX_AGE":  &rotation.MaxAge,
+	} {
+		if value := os.Getenv(key); value != "" {
+			duration, err := time.ParseDuration(value)
+			if err != nil || duration < 0 {
+				return LogRotation{}, ErrorInvalidLogRotation
+			}
+			*target = duration
+		}
+	}
+
+	if backups := os.Getenv("LOG_ROTATE_MAX_BACKUPS"); backups != "" {
+		count, err := strconv.Atoi(backups)
+		if err != nil || count < 0 {
+			return LogRotation{}, ErrorInvalidLogRotation
+		}
+		rotation.MaxBackups = count
+	}
+
+	rotation.Compress = os.Getenv("LOG_ROTATE_COMPRESS") == "true"
+
+	return rotation, nil
+}
+
+// OpenRotatingFile opens path for appending, rotating it as rotation says.
+func OpenRotatingFile(path string, rotation LogRotation) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, rotation: rotation}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// open opens the file at path, the caller holds the lock. A file that holds
+// lines already counts as opened when it was last written, so restarting
+// does not put off rotating it by time.
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file = file
+	r.size = info.Size()
+	r.opened = time.Now()
+	if r.size > 0 {
+		r.opened = info.ModTime()
+	}
+
+	return nil
+}
+
+// Write appends to the file, rotating it first when the write would make it
+// too large or an interval started since it was opened. Intervals start at
+// whole multiples of Interval, midnight UTC for 24h. A file that can not be
+// moved aside is written to anyway and rotating it is retried later.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+
+	if r.file == nil {
+		r.mu.Unlock()
+		return 0, os.ErrClosed
+	}
+
+	var rotateErr error
+	now := time.Now()
+	tooLarge := r.rotation.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.rotation.MaxSize
+	tooOld := r.rotation.Interval > 0 && now.Truncate(r.rotation.Interval).After(r.opened.Truncate(r.rotation.Interval))
+	if (tooLarge || tooOld) && !now.Before(r.retryAt) {
+		if rotateErr = r.rotate(now); r.file == nil {
+			r.mu.Unlock()
+			return 0, rotateErr
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	r.mu.Unlock()
+
+	// Logged without the lock, the logger may well write to this file.
+	ErrorLogger(rotateErr, fmt.Sprintf("Could not rotate log file %s, still writing to it.", r.path))
+
+	return n, err
+}
+
+// rotate moves the file aside and opens a new one, the caller holds the lock
+// so no write is lost in between. Compressing and pruning old files is done
+// in the background.
+func (r *RotatingFile) rotate(now time.Time) error {
+	closeErr := r.file.Close()
+	rotated := rotatedName(r.path, now)
+	renameErr := os.Rename(r.path, rotated)
+
+	// Whatever happened to the old file, keep logging.
+	if err := r.open(); err != nil {
+		r.file = nil
+		return err
+	}
+	if renameErr != nil {
+		r.retryAt = now.Add(rotateRetryInterval)
+		return renameErr
+	}
+
+	r.cleanups.Add(1)
+	go func() {
+		defer r.cleanups.Done()
+
+		r.cleanupMu.Lock()
+		defer r.cleanupMu.Unlock()
+
+		if r.rotation.Compress {
+			ErrorLogger(compressRotated(rotated), "Could not compress rotated log file.")
+		}
+		ErrorLogger(r.prune(), "Could not remove old log files.")
+	}()
+
+	return closeErr
+}
+
+// rotatedName names the file path is rotated to at now, a millisecond later
+// when a file rotated in the same millisecond is still there.
+func rotatedName(path string, now time.Time) string {
+	for {
+		rotated := path + "." + now.Format(rotatedTimeFormat)
+		_, err := os.Stat(rotated)
+		_, gzErr := os.Stat(rotated + ".gz")
+		if err != nil && gzErr != nil {
+			return rotated
+		}
+		now = now.Add(time.Millisecond)
+	}
+}
+
+// compressRotated gzips a rotated file and removes it.
+func compressRotated(rotated string) error {
+	in, err := os.Open(rotated)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(rotated+".gz.tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err == nil {
+		err = gz.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(rotated + ".gz.tmp")
+		return err
+	}
+
+	if err := os.Rename(rotated+".gz.tmp", rotated+".gz"); err != nil {
+		return err
+	}
+
+	return os.Remove(rotated)
+}
+
+// prune removes rotated files beyond MaxBackups or older than MaxAge.
+func (r *RotatingFile) prune() error {
+	if r.rotation.MaxBackups <= 0 && r.rotation.MaxAge <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return err
+	}
+
+	type backup struct {
+		name    string
+		rotated time.Time
+	}
+	backups := []backup{}
+	for _, name := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, r.path+"."), ".gz")
+		rotated, err := time.ParseInLocation(rotatedTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{name: name, rotated: rotated})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].rotated.After(backups[j].rotated) })
+
+	var failed error
+	for i, old := range backups {
+		tooMany := r.rotation.MaxBackups > 0 && i >= r.rotation.MaxBackups
+		tooOld := r.rotation.MaxAge > 0 && time.Since(old.rotated) > r.rotation.MaxAge
+		if tooMany || tooOld {
+			if err := os.Remove(old.name); err != nil {
+				failed = err
+			}
+		}
+	}
+
+	return failed
+}
+
+// Reopen closes the file and opens path again, for after the file was
+// rotated by something else such as logrotate.
+func (r *RotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file != nil {
+		r.file.Close()
+	}
+
+	if err := r.open(); err != nil {
+		r.file = nil
+		return err
+	}
+
+	return nil
+}
+
+// Close closes the file once rotated files are compressed and pruned.
+func (r *RotatingFile) Close() error {
+	r.cleanups.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+
+	return err
+}
+
+// reopenLogFilesOnHangup reopens the log files of the file sinks on SIGHUP.
+func reopenLogFilesOnHangup() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		for range hangup {
+			logFilesMu.Lock()
+			files := logFiles
+			logFilesMu.Unlock()
+
+			for _, file := range files {
+				ErrorLogger(file.Reopen(), fmt.Sprintf("Could not reopen log file %s.", file.path))
+			}
+		}
+	}()
+}
@@ -0,0 +1,257 @@
+package tyrgin
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rotatedFiles returns the rotated files of path, newest last.
+func rotatedFiles(t *testing.T, path string) []string {
+	matches, err := filepath.Glob(path + ".*")
+	assert.Nil(t, err)
+	sort.Strings(matches)
+
+	return matches
+}
+
+func TestLogRotationFromEnv(t *testing.T) {
+	keys := []string{"LOG_ROTATE_MAX_SIZE_MB", "LOG_ROTATE_INTERVAL", "LOG_ROTATE_MAX_AGE", "LOG_ROTATE_MAX_BACKUPS", "LOG_ROTATE_COMPRESS"}
+	for _, key := range keys {
+		defer os.Setenv(key, os.Getenv(key))
+	}
+
+	os.Setenv("LOG_ROTATE_MAX_SIZE_MB", "5")
+	os.Setenv("LOG_ROTATE_INTERVAL", "24h")
+	os.Setenv("LOG_ROTATE_MAX_AGE", "720h")
+	os.Setenv("LOG_ROTATE_MAX_BACKUPS", "7")
+	os.Setenv("LOG_ROTATE_COMPRESS", "true")
+	rotation, err := LogRotationFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, LogRotation{
+		MaxSize:    5 << 20,
+		Interval:   24 * time.Hour,
+		MaxAge:     720 * time.Hour,
+		MaxBackups: 7,
+		Compress:   true,
+	}, rotation)
+
+	config, err := LogConfigFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, rotation, config.Sinks[0].Rotation)
+
+	os.Setenv("LOG_ROTATE_INTERVAL", "daily")
+	_, err = LogRotationFromEnv()
+	assert.Equal(t, ErrorInvalidLogRotation, err)
+	_, err = LogConfigFromEnv()
+	assert.Equal(t, ErrorInvalidLogRotation, err)
+
+	for _, key := range keys {
+		os.Setenv(key, "")
+	}
+	rotation, err = LogRotationFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, LogRotation{}, rotation)
+}
+
+func TestRotatingFileSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyrgin-rotate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log.json")
+	file, err := OpenRotatingFile(path, LogRotation{MaxSize: 16, MaxBackups: 2, Compress: true})
+	assert.Nil(t, err)
+
+	lines := []string{"first line\n", "second line\n", "third line\n", "fourth line\n"}
+	for _, line := range lines {
+		_, err := file.Write([]byte(line))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, file.Close())
+
+	current, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, lines[3], string(current))
+
+	// Only the two newest rotated files are kept, compressed.
+	rotated := rotatedFiles(t, path)
+	assert.Len(t, rotated, 2)
+	for i, name := range rotated {
+		assert.True(t, strings.HasSuffix(name, ".gz"))
+
+		in, err := os.Open(name)
+		assert.Nil(t, err)
+		gz, err := gzip.NewReader(in)
+		assert.Nil(t, err)
+		content, err := ioutil.ReadAll(gz)
+		assert.Nil(t, err)
+		in.Close()
+		assert.Equal(t, lines[i+1], string(content))
+	}
+}
+
+func TestRotatingFileConcurrentWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyrgin-rotate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log.json")
+	file, err := OpenRotatingFile(path, LogRotation{MaxSize: 256})
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				file.Write([]byte("a line that is written many times\n"))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Nil(t, file.Close())
+
+	// No line is lost or torn by rotating.
+	count := 0
+	for _, name := range append(rotatedFiles(t, path), path) {
+		content, err := ioutil.ReadFile(name)
+		assert.Nil(t, err)
+		for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+			assert.Equal(t, "a line that is written many times", line)
+			count++
+		}
+	}
+	assert.Equal(t, 400, count)
+}
+
+func TestRotatingFileInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyrgin-rotate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log.json")
+	file, err := OpenRotatingFile(path, LogRotation{Interval: time.Hour})
+	assert.Nil(t, err)
+	defer file.Close()
+
+	file.Write([]byte("old\n"))
+	file.Write([]byte("old\n"))
+	assert.Len(t, rotatedFiles(t, path), 0)
+
+	file.opened = file.opened.Add(-time.Hour)
+	file.Write([]byte("new\n"))
+
+	rotated := rotatedFiles(t, path)
+	assert.Len(t, rotated, 1)
+	content, err := ioutil.ReadFile(rotated[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "old\nold\n", string(content))
+}
+
+func TestRotatingFileIntervalAfterRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyrgin-rotate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// A file last written in an earlier interval is rotated on the first
+	// write after opening it again.
+	path := filepath.Join(dir, "log.json")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("yesterday\n"), 0644))
+	lastWritten := time.Now().Add(-25 * time.Hour)
+	assert.Nil(t, os.Chtimes(path, lastWritten, lastWritten))
+
+	file, err := OpenRotatingFile(path, LogRotation{Interval: 24 * time.Hour})
+	assert.Nil(t, err)
+	defer file.Close()
+	file.Write([]byte("today\n"))
+
+	rotated := rotatedFiles(t, path)
+	assert.Len(t, rotated, 1)
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "today\n", string(content))
+}
+
+func TestRotatingFileRenameFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyrgin-rotate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// The timestamp makes the rotated name too long to rename to.
+	path := filepath.Join(dir, strings.Repeat("l", 250))
+	file, err := OpenRotatingFile(path, LogRotation{MaxSize: 4})
+	assert.Nil(t, err)
+	defer file.Close()
+
+	for _, line := range []string{"one\n", "two\n", "three\n"} {
+		n, err := file.Write([]byte(line))
+		assert.Nil(t, err)
+		assert.Equal(t, len(line), n)
+	}
+	assert.False(t, file.retryAt.IsZero())
+
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "one\ntwo\nthree\n", string(content))
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyrgin-rotate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log.json")
+	old := path + "." + time.Now().Add(-48*time.Hour).Format(rotatedTimeFormat) + ".gz"
+	recent := path + "." + time.Now().Add(-time.Hour).Format(rotatedTimeFormat)
+	unrelated := path + ".backup"
+	for _, name := range []string{old, recent, unrelated} {
+		assert.Nil(t, ioutil.WriteFile(name, []byte("log\n"), 0644))
+	}
+
+	file, err := OpenRotatingFile(path, LogRotation{MaxSize: 1, MaxAge: 24 * time.Hour})
+	assert.Nil(t, err)
+	file.Write([]byte("one\n"))
+	file.Write([]byte("two\n"))
+	assert.Nil(t, file.Close())
+
+	_, err = os.Stat(old)
+	assert.True(t, os.IsNotExist(err))
+	for _, name := range []string{recent, unrelated} {
+		_, err = os.Stat(name)
+		assert.Nil(t, err)
+	}
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyrgin-rotate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log.json")
+	file, err := OpenRotatingFile(path, LogRotation{})
+	assert.Nil(t, err)
+	defer file.Close()
+
+	file.Write([]byte("before\n"))
+	assert.Nil(t, os.Rename(path, path+".1"))
+	file.Write([]byte("still before\n"))
+	assert.Nil(t, file.Reopen())
+	file.Write([]byte("after\n"))
+
+	moved, err := ioutil.ReadFile(path + ".1")
+	assert.Nil(t, err)
+	assert.Equal(t, "before\nstill before\n", string(moved))
+	current, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "after\n", string(current))
+}
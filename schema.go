@@ -0,0 +1,531 @@
+package tyrgin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/mail"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// ProblemContentType is the content type of problem details, RFC 7807.
+const ProblemContentType = "application/problem+json"
+
+// NewJSONSchema compiles a JSON Schema document. The validation keywords of
+// draft 7 are supported except patternProperties, propertyNames, contains,
+// dependencies and if, then and else, which give ErrorInvalidSchema rather
+// than being ignored, and $ref only points within the document. The formats
+// date-time, date and email are checked, others and contents are not.
+func NewJSONSchema(document []byte) (*JSONSchema, error) {
+	var root interface{}
+	if err := json.Unmarshal(document, &root); err != nil {
+		return nil, err
+	}
+
+	schema := &JSONSchema{root: root, patterns: make(map[string]*regexp.Regexp)}
+	if err := schema.compile(root, map[string]bool{}); err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+// LoadJSONSchema compiles the JSON Schema document at path.
+func LoadJSONSchema(path string) (*JSONSchema, error) {
+	document, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewJSONSchema(document)
+}
+
+// unsupportedSchemaKeywords are the draft 7 keywords validate does not check.
+var unsupportedSchemaKeywords = []string{"patternProperties", "propertyNames", "contains", "dependencies", "if", "then", "else"}
+
+// compile checks a (sub)schema, compiles its patterns and resolves its
+// references once so validating never runs into a broken schema. It walks
+// every subschema validate may use, including the targets of references,
+// which are compiled once each as references may be recursive.
+func (s *JSONSchema) compile(node interface{}, refs map[string]bool) error {
+	if _, ok := node.(bool); ok {
+		return nil
+	}
+
+	schema, ok := node.(map[string]interface{})
+	if !ok {
+		return ErrorInvalidSchema
+	}
+
+	for _, keyword := range unsupportedSchemaKeywords {
+		if _, ok := schema[keyword]; ok {
+			return ErrorInvalidSchema
+		}
+	}
+
+	if pattern, ok := schema["pattern"].(string); ok {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return ErrorInvalidSchema
+		}
+		s.patterns[pattern] = compiled
+	}
+
+	children := []interface{}{}
+	if ref, ok := schema["$ref"].(string); ok && !refs[ref] {
+		refs[ref] = true
+		target, err := s.resolve(ref)
+		if err != nil {
+			return err
+		}
+		children = append(children, target)
+	}
+
+	for _, key := range []string{"additionalProperties", "additionalItems", "not"} {
+		if child, ok := schema[key]; ok {
+			children = append(children, child)
+		}
+	}
+
+	switch items := schema["items"].(type) {
+	case nil:
+	case []interface{}:
+		children = append(children, items...)
+	default:
+		children = append(children, items)
+	}
+
+	for _, key := range []string{"properties", "definitions", "$defs"} {
+		if named, ok := schema[key].(map[string]interface{}); ok {
+			for _, child := range named {
+				children = append(children, child)
+			}
+		}
+	}
+
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		if list, ok := schema[key].([]interface{}); ok {
+			children = append(children, list...)
+		}
+	}
+
+	for _, child := range children {
+		if err := s.compile(child, refs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolve follows a $ref, a JSON pointer within the document.
+func (s *JSONSchema) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, ErrorInvalidSchema
+	}
+
+	node := s.root
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer == "" {
+		return node, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, ErrorInvalidSchema
+	}
+
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+
+		switch current := node.(type) {
+		case map[string]interface{}:
+			next, ok := current[token]
+			if !ok {
+				return nil, ErrorInvalidSchema
+			}
+			node = next
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(current) {
+				return nil, ErrorInvalidSchema
+			}
+			node = current[index]
+		default:
+			return nil, ErrorInvalidSchema
+		}
+	}
+
+	return node, nil
+}
+
+// Validate checks a JSON document against the schema, returning every place
+// it breaks the schema.
+func (s *JSONSchema) Validate(document []byte) []SchemaViolation {
+	var value interface{}
+	if err := json.Unmarshal(document, &value); err != nil {
+		return []SchemaViolation{{Pointer: "", Message: "is not valid JSON"}}
+	}
+
+	return s.validate(s.root, value, "")
+}
+
+// schemaNumber returns a numeric keyword of a schema.
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	number, ok := schema[key].(float64)
+	return number, ok
+}
+
+// jsonType returns the JSON Schema type of a decoded value.
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// matchesType reports whether a value is of the type, or one of the types,
+// of the type keyword.
+func matchesType(types interface{}, value interface{}) bool {
+	actual := jsonType(value)
+
+	var allowed []interface{}
+	if list, ok := types.([]interface{}); ok {
+		allowed = list
+	} else {
+		allowed = []interface{}{types}
+	}
+
+	for _, name := range allowed {
+		if name == actual || (name == "number" && actual == "integer") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// escapePointer escapes a property name for a JSON pointer.
+func escapePointer(name string) string {
+	return strings.Replace(strings.Replace(name, "~", "~0", -1), "/", "~1", -1)
+}
+
+// validate checks a decoded value against a (sub)schema, pointer is where
+// the value is in the document.
+func (s *JSONSchema) validate(node interface{}, value interface{}, pointer string) []SchemaViolation {
+	schema, ok := node.(map[string]interface{})
+	if !ok {
+		if node == false {
+			return []SchemaViolation{{Pointer: pointer, Message: "is not allowed"}}
+		}
+		return nil
+	}
+
+	// As in draft 7 the keywords next to a $ref are ignored.
+	if ref, ok := schema["$ref"].(string); ok {
+		target, _ := s.resolve(ref)
+		return s.validate(target, value, pointer)
+	}
+
+	violations := []SchemaViolation{}
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, SchemaViolation{Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if types, ok := schema["type"]; ok && !matchesType(types, value) {
+		fail("must be of type %v", types)
+		return violations
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if reflect.DeepEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %v", enum)
+		}
+	}
+
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, value) {
+		fail("must be %v", constant)
+	}
+
+	switch value := value.(type) {
+	case string:
+		length := float64(utf8.RuneCountInString(value))
+		if min, ok := schemaNumber(schema, "minLength"); ok && length < min {
+			fail("must be at least %v characters long", min)
+		}
+		if max, ok := schemaNumber(schema, "maxLength"); ok && length > max {
+			fail("must be at most %v characters long", max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok && !s.patterns[pattern].MatchString(value) {
+			fail("must match %s", pattern)
+		}
+		if format, ok := schema["format"].(string); ok && !matchesFormat(format, value) {
+			fail("must be a valid %s", format)
+		}
+
+	case float64:
+		if min, ok := schemaNumber(schema, "minimum"); ok && value < min {
+			fail("must be at least %v", min)
+		}
+		if max, ok := schemaNumber(schema, "maximum"); ok && value > max {
+			fail("must be at most %v", max)
+		}
+		if min, ok := schemaNumber(schema, "exclusiveMinimum"); ok && value <= min {
+			fail("must be more than %v", min)
+		}
+		if max, ok := schemaNumber(schema, "exclusiveMaximum"); ok && value >= max {
+			fail("must be less than %v", max)
+		}
+		if factor, ok := schemaNumber(schema, "multipleOf"); ok && factor > 0 {
+			if quotient := value / factor; quotient != math.Trunc(quotient) {
+				fail("must be a multiple of %v", factor)
+			}
+		}
+
+	case []interface{}:
+		count := float64(len(value))
+		if min, ok := schemaNumber(schema, "minItems"); ok && count < min {
+			fail("must have at least %v items", min)
+		}
+		if max, ok := schemaNumber(schema, "maxItems"); ok && count > max {
+			fail("must have at most %v items", max)
+		}
+		if unique, _ := schema["uniqueItems"].(bool); unique {
+		unique:
+			for i := range value {
+				for j := i + 1; j < len(value); j++ {
+					if reflect.DeepEqual(value[i], value[j]) {
+						fail("must not have duplicate items")
+						break unique
+					}
+				}
+			}
+		}
+
+		switch items := schema["items"].(type) {
+		case nil:
+		case []interface{}:
+			for i, item := range value {
+				if i >= len(items) {
+					if additional, ok := schema["additionalItems"]; ok {
+						violations = append(violations, s.validate(additional, item, pointer+"/"+strconv.Itoa(i))...)
+					}
+					continue
+				}
+				violations = append(violations, s.validate(items[i], item, pointer+"/"+strconv.Itoa(i))...)
+			}
+		default:
+			for i, item := range value {
+				violations = append(violations, s.validate(items, item, pointer+"/"+strconv.Itoa(i))...)
+			}
+		}
+
+	case map[string]interface{}:
+		count := float64(len(value))
+		if min, ok := schemaNumber(schema, "minProperties"); ok && count < min {
+			fail("must have at least %v properties", min)
+		}
+		if max, ok := schemaNumber(schema, "maxProperties"); ok && count > max {
+			fail("must have at most %v properties", max)
+		}
+
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if name, ok := name.(string); ok {
+					if _, present := value[name]; !present {
+						violations = append(violations, SchemaViolation{
+							Pointer: pointer + "/" + escapePointer(name),
+							Message: "is required",
+						})
+					}
+				}
+			}
+		}
+
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		additional, restricted := schema["additionalProperties"]
+		for _, name := range names {
+			at := pointer + "/" + escapePointer(name)
+			if property, ok := properties[name]; ok {
+				violations = append(violations, s.validate(property, value[name], at)...)
+			} else if restricted {
+				violations = append(violations, s.validate(additional, value[name], at)...)
+			}
+		}
+	}
+
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, child := range allOf {
+			violations = append(violations, s.validate(child, value, pointer)...)
+		}
+	}
+
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, child := range anyOf {
+			if len(s.validate(child, value, pointer)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("must match at least one schema of anyOf")
+		}
+	}
+
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, child := range oneOf {
+			if len(s.validate(child, value, pointer)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			fail("must match exactly one schema of oneOf")
+		}
+	}
+
+	if not, ok := schema["not"]; ok && len(s.validate(not, value, pointer)) == 0 {
+		fail("must not match the schema of not")
+	}
+
+	return violations
+}
+
+// matchesFormat checks the formats that are supported, any other passes.
+func matchesFormat(format, value string) bool {
+	var err error
+	switch format {
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, value)
+	case "date":
+		_, err = time.Parse("2006-01-02", value)
+	case "email":
+		_, err = mail.ParseAddress(value)
+	}
+
+	return err == nil
+}
+
+// problem sends problem details for the schema violations.
+func problem(c *gin.Context, err error, status int, violations []SchemaViolation) {
+	c.Header("Content-Type", ProblemContentType)
+	c.AbortWithStatusJSON(status, ProblemDetails{
+		Type:       "about:blank",
+		Title:      http.StatusText(status),
+		Status:     status,
+		Detail:     err.Error(),
+		Instance:   c.Request.URL.Path,
+		Violations: violations,
+	})
+	c.Error(err)
+}
+
+// ValidateRequest returns a middleware checking request bodies against a
+// schema. A body breaking it is logged and refused with a 400 holding
+// problem details. The body is put back for the handlers to bind.
+func ValidateRequest(schema *JSONSchema) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body []byte
+		if c.Request.Body != nil {
+			var err error
+			body, err = ioutil.ReadAll(c.Request.Body)
+			if err == ErrorRequestBodyTooLarge {
+				bodyTooLarge(c)
+				return
+			}
+			if err != nil {
+				resourceError(c, err, http.StatusBadRequest)
+				return
+			}
+			c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		if violations := schema.Validate(body); len(violations) > 0 {
+			ContextLogger(c).WithFields(log.Fields{
+				"message":    ErrorRequestSchema.Error(),
+				"violations": violations,
+			}).Warn("Schema Violation")
+			problem(c, ErrorRequestSchema, http.StatusBadRequest, violations)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ValidateResponse returns a middleware checking successful JSON responses
+// against a schema. A response breaking it is logged and replaced with a
+// 500 holding problem details. Responses are only checked when ENV is dev or
+// test, elsewhere the middleware does nothing.
+func ValidateResponse(schema *JSONSchema) gin.HandlerFunc {
+	if env := os.Getenv("ENV"); env != "dev" && env != "test" {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	return func(c *gin.Context) {
+		original := c.Writer
+		writer := &heldWriter{ResponseWriter: original, header: make(http.Header)}
+		c.Writer = writer
+		// A panicking handler leaves its response behind for Recovery's.
+		defer func() {
+			c.Writer = original
+		}()
+
+		c.Next()
+
+		c.Writer = original
+		status := original.Status()
+		if status >= 200 && status < 300 && writer.body.Len() > 0 && strings.Contains(writer.header.Get("Content-Type"), "json") {
+			if violations := schema.Validate(writer.body.Bytes()); len(violations) > 0 {
+				ContextLogger(c).WithFields(log.Fields{
+					"message":    ErrorResponseSchema.Error(),
+					"violations": violations,
+				}).Error("Schema Violation")
+				problem(c, ErrorResponseSchema, http.StatusInternalServerError, violations)
+				return
+			}
+		}
+
+		writer.release()
+	}
+}
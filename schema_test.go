@@ -0,0 +1,168 @@
+package tyrgin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const submissionSchema = `{
+	"type": "object",
+	"required": ["assignment", "files"],
+	"additionalProperties": false,
+	"properties": {
+		"assignment": {"type": "string", "pattern": "^[0-9a-f]{24}$"},
+		"attempt": {"type": "integer", "minimum": 1, "maximum": 3},
+		"language": {"enum": ["python", "java", "c"]},
+		"submittedAt": {"type": "string", "format": "date-time"},
+		"files": {"type": "array", "minItems": 1, "uniqueItems": true, "items": {"$ref": "#/definitions/file"}}
+	},
+	"definitions": {
+		"file": {
+			"type": "object",
+			"required": ["name"],
+			"properties": {"name": {"type": "string", "minLength": 1}}
+		}
+	}
+}`
+
+func TestJSONSchemaValidate(t *testing.T) {
+	schema, err := NewJSONSchema([]byte(submissionSchema))
+	assert.Nil(t, err)
+
+	valid := `{"assignment": "5c6b1f1e8d1e4a2b3c4d5e6f", "attempt": 2, "language": "c", "submittedAt": "2019-02-20T10:00:00Z", "files": [{"name": "main.c"}]}`
+	assert.Empty(t, schema.Validate([]byte(valid)))
+
+	violations := schema.Validate([]byte(`{"assignment": "hw1", "attempt": 1.5, "language": "go", "submittedAt": "today", "files": [{"name": ""}, {"name": ""}], "grade": 100}`))
+	assert.ElementsMatch(t, []SchemaViolation{
+		{Pointer: "/assignment", Message: "must match ^[0-9a-f]{24}$"},
+		{Pointer: "/attempt", Message: "must be of type integer"},
+		{Pointer: "/files", Message: "must not have duplicate items"},
+		{Pointer: "/files/0/name", Message: "must be at least 1 characters long"},
+		{Pointer: "/files/1/name", Message: "must be at least 1 characters long"},
+		{Pointer: "/grade", Message: "is not allowed"},
+		{Pointer: "/language", Message: "must be one of [python java c]"},
+		{Pointer: "/submittedAt", Message: "must be a valid date-time"},
+	}, violations)
+
+	assert.Equal(t, []SchemaViolation{{Pointer: "/assignment", Message: "is required"}},
+		schema.Validate([]byte(`{"files": [{"name": "a.py"}]}`)))
+	assert.Equal(t, []SchemaViolation{{Pointer: "", Message: "is not valid JSON"}}, schema.Validate(nil))
+
+	combined, err := NewJSONSchema([]byte(`{"oneOf": [{"type": "integer"}, {"type": "number", "minimum": 10}], "not": {"const": 42}}`))
+	assert.Nil(t, err)
+	assert.Empty(t, combined.Validate([]byte(`5`)))
+	assert.Len(t, combined.Validate([]byte(`12`)), 1)
+	assert.Len(t, combined.Validate([]byte(`42`)), 2)
+	assert.Empty(t, combined.Validate([]byte(`10.5`)))
+
+	// Patterns are compiled wherever validation may reach them.
+	tuple, err := NewJSONSchema([]byte(`{"items": [{}], "additionalItems": {"pattern": "^a"}}`))
+	assert.Nil(t, err)
+	assert.Len(t, tuple.Validate([]byte(`[1, "a", "b"]`)), 1)
+	referenced, err := NewJSONSchema([]byte(`{"components": {"name": {"pattern": "^a"}}, "$ref": "#/components/name"}`))
+	assert.Nil(t, err)
+	assert.Len(t, referenced.Validate([]byte(`"b"`)), 1)
+	recursive, err := NewJSONSchema([]byte(`{"properties": {"child": {"$ref": "#"}, "name": {"pattern": "^a"}}}`))
+	assert.Nil(t, err)
+	assert.Len(t, recursive.Validate([]byte(`{"child": {"name": "b"}}`)), 1)
+}
+
+func TestNewJSONSchemaInvalid(t *testing.T) {
+	for _, document := range []string{
+		`{"pattern": "("}`,
+		`{"$ref": "#/definitions/missing"}`,
+		`{"properties": {"name": 5}}`,
+		`{"$ref": "other.json"}`,
+		`{"items": [{}], "additionalItems": {"pattern": "("}}`,
+		`{"components": {"name": {"pattern": "("}}, "$ref": "#/components/name"}`,
+		`{"patternProperties": {"^x-": {"type": "string"}}}`,
+		`{"properties": {"tags": {"contains": {"const": "hw1"}}}}`,
+		`{"if": {"required": ["late"]}, "then": {"required": ["reason"]}}`,
+		`{"propertyNames": {"maxLength": 3}}`,
+	} {
+		_, err := NewJSONSchema([]byte(document))
+		assert.Equal(t, ErrorInvalidSchema, err, document)
+	}
+
+	_, err := NewJSONSchema([]byte(`{`))
+	assert.NotNil(t, err)
+}
+
+func TestSchemaMiddleware(t *testing.T) {
+	requestSchema, err := NewJSONSchema([]byte(submissionSchema))
+	assert.Nil(t, err)
+	responseSchema, err := NewJSONSchema([]byte(`{"type": "object", "required": ["id"], "properties": {"id": {"type": "string"}}}`))
+	assert.Nil(t, err)
+
+	submit := NewRoute(func(c *gin.Context) {
+		var body map[string]interface{}
+		assert.Nil(t, c.ShouldBindJSON(&body))
+
+		if body["attempt"] == float64(3) {
+			c.JSON(http.StatusCreated, gin.H{"id": 3})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"id": "5c6b1f1e8d1e4a2b3c4d5e70"})
+	}, "submissions", POST)
+	submit.RequestSchema = requestSchema
+	submit.ResponseSchema = responseSchema
+
+	router := gin.New()
+	AddRoutes(router, false, nil, "1", "test", []APIAction{submit})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/test/submissions", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(`{"assignment": "5c6b1f1e8d1e4a2b3c4d5e6f", "files": [{"name": "main.c"}]}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"id": "5c6b1f1e8d1e4a2b3c4d5e70"}`, w.Body.String())
+
+	w = post(`{"files": []}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	var problem ProblemDetails
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, http.StatusBadRequest, problem.Status)
+	assert.Equal(t, ErrorRequestSchema.Error(), problem.Detail)
+	assert.Equal(t, "/api/v1/test/submissions", problem.Instance)
+	assert.Len(t, problem.Violations, 2)
+
+	w = post(`{"assignment": "5c6b1f1e8d1e4a2b3c4d5e6f", "attempt": 3, "files": [{"name": "main.c"}]}`)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	problem = ProblemDetails{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, ErrorResponseSchema.Error(), problem.Detail)
+	assert.Equal(t, []SchemaViolation{{Pointer: "/id", Message: "must be of type string"}}, problem.Violations)
+}
+
+func TestValidateResponsePanic(t *testing.T) {
+	responseSchema, err := NewJSONSchema([]byte(`{"type": "object"}`))
+	assert.Nil(t, err)
+
+	panics := NewRoute(func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"id": "partial"})
+		panic("boom")
+	}, "panics", GET)
+	panics.ResponseSchema = responseSchema
+
+	router := gin.New()
+	router.Use(Recovery())
+	AddRoutes(router, false, nil, "1", "test", []APIAction{panics})
+
+	w := performRequest(router, "GET", "/api/v1/test/panics", nil)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "application/json+error", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), ErrorPanicRecovered.Error())
+	assert.NotContains(t, w.Body.String(), "partial")
+}
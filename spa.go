@@ -0,0 +1,161 @@
+package tyrgin
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hashedAssetPattern matches file names carrying a content hash, such as
+// main.3f2a9c1b.js or chunk-3f2a9c1b.css, which can be cached forever.
+var hashedAssetPattern = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[^/]+$`)
+
+var defaultSPAReservedPrefixes = []string{"/api", "/status"}
+
+const defaultSPAAssetMaxAge = 365 * 24 * time.Hour
+
+// withSPADefaults fills in the unset fields of config.
+func withSPADefaults(config SPAConfig) SPAConfig {
+	if config.FileSystem == nil {
+		dir := config.Dir
+		if dir == "" {
+			dir = "./static"
+		}
+		config.FileSystem = http.Dir(dir)
+	}
+	if config.Index == "" {
+		config.Index = "index.html"
+	}
+	if config.ReservedPrefixes == nil {
+		config.ReservedPrefixes = defaultSPAReservedPrefixes
+	}
+	if config.AssetMaxAge == 0 {
+		config.AssetMaxAge = defaultSPAAssetMaxAge
+	}
+
+	return config
+}
+
+// reserved reports whether urlPath is under one of the prefixes.
+func reserved(urlPath string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if urlPath == prefix || strings.HasPrefix(urlPath, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pageNotFound sends the JSON 404.
+func pageNotFound(c *gin.Context) {
+	ErrorHandler(ErrorPageNotFound, c, http.StatusNotFound, gin.H{
+		"statusCode": http.StatusNotFound,
+		"message":    NotFoundError,
+	})
+}
+
+// addVary adds value to the Vary header unless it is already there.
+func addVary(header http.Header, value string) {
+	for _, vary := range header["Vary"] {
+		for _, field := range strings.Split(vary, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
+
+// openFile opens name in fs, returning nil unless it is a regular file.
+func openFile(fs http.FileSystem, name string) (http.File, os.FileInfo) {
+	file, err := fs.Open(name)
+	if err != nil {
+		return nil, nil
+	}
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		file.Close()
+		return nil, nil
+	}
+
+	return file, info
+}
+
+// serveFile sends name from the file system of config, or its precompressed
+// .gz sibling when there is one and the client accepts gzip. It returns false
+// when there is no such file.
+func serveFile(c *gin.Context, config SPAConfig, name string) bool {
+	file, info := openFile(config.FileSystem, name)
+	if file == nil {
+		return false
+	}
+	defer file.Close()
+
+	header := c.Writer.Header()
+	if path.Base(name) == config.Index {
+		header.Set("Cache-Control", "no-cache")
+	} else if hashedAssetPattern.MatchString(name) {
+		header.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(config.AssetMaxAge.Seconds()))+", immutable")
+	}
+
+	if gzipped, gzippedInfo := openFile(config.FileSystem, name+".gz"); gzipped != nil {
+		defer gzipped.Close()
+		addVary(header, "Accept-Encoding")
+
+		if negotiateEncoding(c.GetHeader("Accept-Encoding")) == "gzip" {
+			contentType := mime.TypeByExtension(path.Ext(name))
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			header.Set("Content-Type", contentType)
+			header.Set("Content-Encoding", "gzip")
+			http.ServeContent(c.Writer, c.Request, name, gzippedInfo.ModTime(), gzipped)
+			return true
+		}
+	}
+
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime(), file)
+	return true
+}
+
+// SPA returns a handler serving a single-page app, meant to be the NoRoute
+// handler of the router so it can never shadow a route. Files that exist are
+// served as they are. Other GET requests for paths without an extension are
+// given the index so the app can route them itself. Everything else, and all
+// paths under the reserved prefixes, gets a JSON 404.
+func SPA(config SPAConfig) gin.HandlerFunc {
+	config = withSPADefaults(config)
+
+	return func(c *gin.Context) {
+		urlPath := path.Clean("/" + c.Request.URL.Path)
+		if reserved(urlPath, config.ReservedPrefixes) ||
+			(c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) {
+			pageNotFound(c)
+			return
+		}
+
+		if serveFile(c, config, urlPath) {
+			return
+		}
+
+		if path.Ext(urlPath) == "" && serveFile(c, config, "/"+config.Index) {
+			return
+		}
+
+		pageNotFound(c)
+	}
+}
+
+// ServeSPA serves a single-page app from r as described by config.
+func ServeSPA(r *gin.Engine, config SPAConfig) {
+	r.NoRoute(SPA(config))
+}
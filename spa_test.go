@@ -0,0 +1,86 @@
+package tyrgin
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var spaActions = []APIAction{
+	NewRoute(func(c *gin.Context) { c.String(http.StatusOK, "hello") }, "hello", GET),
+}
+
+func setupSPADir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "spa")
+	assert.Nil(t, err)
+
+	ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>app</html>"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "robots.txt"), []byte("robots"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "main.3f2a9c1b.js"), []byte("console.log('app')"), 0644)
+
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	writer.Write([]byte("console.log('app')"))
+	writer.Close()
+	ioutil.WriteFile(filepath.Join(dir, "main.3f2a9c1b.js.gz"), gzipped.Bytes(), 0644)
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestSPAFallback(t *testing.T) {
+	dir, cleanup := setupSPADir(t)
+	defer cleanup()
+	router := newTestRouter(spaActions)
+	ServeSPA(router, SPAConfig{Dir: dir})
+
+	resp := performRequest(router, "GET", "/courses/1", nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "<html>app</html>", resp.Body.String())
+	assert.Equal(t, "no-cache", resp.Header().Get("Cache-Control"))
+
+	resp = performRequest(router, "GET", "/robots.txt", nil)
+	assert.Equal(t, "robots", resp.Body.String())
+	assert.Equal(t, "", resp.Header().Get("Cache-Control"))
+
+	resp = performRequest(router, "GET", "/api/v1/tester/hello", nil)
+	assert.Equal(t, "hello", resp.Body.String())
+
+	for _, path := range []string{"/api/v1/tester/missing", "/status", "/missing.js"} {
+		resp = performRequest(router, "GET", path, nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		assert.Equal(t, "application/json+error", resp.Header().Get("Content-Type"))
+	}
+
+	resp = performRequest(router, "POST", "/courses/1", nil)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestSPAAssets(t *testing.T) {
+	dir, cleanup := setupSPADir(t)
+	defer cleanup()
+	router := newTestRouter(spaActions)
+	ServeSPA(router, SPAConfig{Dir: dir})
+
+	resp := performRequest(router, "GET", "/main.3f2a9c1b.js", nil)
+	assert.Equal(t, "console.log('app')", resp.Body.String())
+	assert.Equal(t, "public, max-age=31536000, immutable", resp.Header().Get("Cache-Control"))
+	assert.Equal(t, "Accept-Encoding", resp.Header().Get("Vary"))
+	assert.Equal(t, "", resp.Header().Get("Content-Encoding"))
+
+	resp = performRequest(router, "GET", "/main.3f2a9c1b.js", nil, "Accept-Encoding", "gzip")
+	assert.Equal(t, "gzip", resp.Header().Get("Content-Encoding"))
+	assert.Contains(t, resp.Header().Get("Content-Type"), "javascript")
+
+	reader, err := gzip.NewReader(resp.Body)
+	assert.Nil(t, err)
+	body, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "console.log('app')", string(body))
+}
@@ -0,0 +1,210 @@
+package tyrgin
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+const defaultSSEHeartbeat = 15 * time.Second
+
+// LastEventIDHeader is the header browsers resume an event stream with.
+const LastEventIDHeader = "Last-Event-ID"
+
+// NewSSEBroker returns a broker keeping the last replaySize events for
+// clients resuming with a Last-Event-ID.
+func NewSSEBroker(replaySize int) *SSEBroker {
+	return &SSEBroker{
+		replaySize:  replaySize,
+		subscribers: map[chan SSEEvent]bool{},
+	}
+}
+
+// Publish sends event to every client streaming from the broker. Events
+// without an ID are numbered. Clients too slow to keep up are disconnected,
+// they resume from the replay buffer when they reconnect.
+func (b *SSEBroker) Publish(event SSEEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sequence++
+	if event.ID == "" {
+		event.ID = strconv.FormatUint(b.sequence, 10)
+	}
+
+	if b.replaySize > 0 {
+		b.replay = append(b.replay, event)
+		if len(b.replay) > b.replaySize {
+			b.replay = b.replay[len(b.replay)-b.replaySize:]
+		}
+	}
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			delete(b.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// subscribe returns the events after lastEventID still in the replay buffer,
+// all of them if it is not there, and a channel for the ones to come.
+func (b *SSEBroker) subscribe(lastEventID string) ([]SSEEvent, chan SSEEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	missed := []SSEEvent{}
+	if lastEventID != "" {
+		start := 0
+		for i, event := range b.replay {
+			if event.ID == lastEventID {
+				start = i + 1
+			}
+		}
+		missed = append(missed, b.replay[start:]...)
+	}
+
+	subscriber := make(chan SSEEvent, 16)
+	b.subscribers[subscriber] = true
+
+	return missed, subscriber
+}
+
+// unsubscribe stops sending events to subscriber.
+func (b *SSEBroker) unsubscribe(subscriber chan SSEEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers[subscriber] {
+		delete(b.subscribers, subscriber)
+		close(subscriber)
+	}
+}
+
+// Stream sends the events missed since lastEventID and then every event
+// published to events, until ctx is done or the client is too slow. It is
+// meant to be called from an SSEFunc.
+func (b *SSEBroker) Stream(ctx context.Context, lastEventID string, events chan<- SSEEvent) {
+	missed, subscriber := b.subscribe(lastEventID)
+	defer b.unsubscribe(subscriber)
+
+	for _, event := range missed {
+		select {
+		case events <- event:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-subscriber:
+			if !ok {
+				return
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// writeSSE writes event to the client and flushes it.
+func writeSSE(c *gin.Context, event SSEEvent) error {
+	err := sse.Encode(c.Writer, sse.Event{
+		Id:    event.ID,
+		Event: event.Event,
+		Retry: uint(event.Retry / time.Millisecond),
+		Data:  event.Data,
+	})
+	c.Writer.Flush()
+
+	return err
+}
+
+// NewSSERoute returns a GET APIAction streaming Server-Sent Events. fn is run
+// in its own goroutine with the Last-Event-ID of the request and sends the
+// events on the channel, it must return once the context of the request is
+// done, which happens when the client goes away. As it runs alongside the
+// stream it may read from c but must not write to it. Heartbeat comments are
+// sent while there are no events, so proxies keep the connection open. The
+// Logger does not keep a copy of the stream, and the route should not be
+// given a Timeout.
+func NewSSERoute(fn SSEFunc, endpoint string, config SSEConfig) APIAction {
+	if config.Heartbeat == 0 {
+		config.Heartbeat = defaultSSEHeartbeat
+	}
+
+	return NewRoute(func(c *gin.Context) {
+		StopResponseCapture(c)
+
+		streamCtx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		c.Request = c.Request.WithContext(streamCtx)
+
+		header := c.Writer.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "keep-alive")
+		header.Set("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Writer.WriteHeaderNow()
+		c.Writer.Flush()
+
+		if config.Retry > 0 {
+			c.Writer.WriteString("retry:" + strconv.FormatInt(int64(config.Retry/time.Millisecond), 10) + "\n\n")
+			c.Writer.Flush()
+		}
+
+		events := make(chan SSEEvent)
+		done := make(chan struct{})
+		lastEventID := c.GetHeader(LastEventIDHeader)
+		go func() {
+			defer close(done)
+			fn(c, lastEventID, events)
+		}()
+
+		heartbeat := time.NewTicker(config.Heartbeat)
+		defer heartbeat.Stop()
+
+	stream:
+		for {
+			select {
+			case event := <-events:
+				if writeSSE(c, event) != nil {
+					break stream
+				}
+			case <-heartbeat.C:
+				if _, err := c.Writer.WriteString(":heartbeat\n\n"); err != nil {
+					break stream
+				}
+				c.Writer.Flush()
+			case <-done:
+				break stream
+			case <-streamCtx.Done():
+				break stream
+			}
+		}
+
+		// Let fn see the stream is over and wait for it, taking whatever it
+		// still sends so it can not block.
+		cancel()
+		for {
+			select {
+			case <-events:
+			case <-done:
+				return
+			}
+		}
+	}, endpoint, GET)
+}
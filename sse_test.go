@@ -0,0 +1,88 @@
+package tyrgin
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func subscriberCount(b *SSEBroker) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+func waitForSubscribers(b *SSEBroker, count int) bool {
+	for i := 0; i < 200; i++ {
+		if subscriberCount(b) == count {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
+
+func TestSSEBrokerReplay(t *testing.T) {
+	broker := NewSSEBroker(2)
+	for _, data := range []string{"a", "b", "c"} {
+		broker.Publish(SSEEvent{Data: data})
+	}
+
+	missed, _ := broker.subscribe("2")
+	assert.Equal(t, []SSEEvent{{ID: "3", Data: "c"}}, missed)
+
+	missed, _ = broker.subscribe("1")
+	assert.Equal(t, []SSEEvent{{ID: "2", Data: "b"}, {ID: "3", Data: "c"}}, missed)
+
+	missed, _ = broker.subscribe("")
+	assert.Equal(t, []SSEEvent{}, missed)
+}
+
+func TestSSERoute(t *testing.T) {
+	broker := NewSSEBroker(10)
+	broker.Publish(SSEEvent{Event: "progress", Data: "10"})
+	broker.Publish(SSEEvent{Event: "progress", Data: "20"})
+
+	progress := NewSSERoute(func(c *gin.Context, lastEventID string, events chan<- SSEEvent) {
+		broker.Stream(c.Request.Context(), lastEventID, events)
+	}, "progress", SSEConfig{Heartbeat: 20 * time.Millisecond})
+
+	router := gin.New()
+	router.Use(Logger())
+	AddRoutes(router, false, nil, "1", "tester", []APIAction{progress})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/api/v1/tester/progress", nil)
+	req.Header.Set(LastEventIDHeader, "1")
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	assert.True(t, waitForSubscribers(broker, 1))
+	broker.Publish(SSEEvent{Event: "progress", Data: gin.H{"percent": 30}})
+
+	reader := bufio.NewReader(resp.Body)
+	stream := ""
+	for !strings.Contains(stream, "id:3") || !strings.Contains(stream, ":heartbeat") {
+		line, err := reader.ReadString('\n')
+		if !assert.Nil(t, err) {
+			break
+		}
+		stream += line
+	}
+	assert.Contains(t, stream, "id:2\nevent:progress\ndata:20")
+	assert.Contains(t, stream, "id:3\nevent:progress\ndata:{\"percent\":30}")
+	assert.NotContains(t, stream, "data:10")
+	assert.Contains(t, stream, ":heartbeat")
+
+	// Going away ends the stream and its subscription.
+	resp.Body.Close()
+	assert.True(t, waitForSubscribers(broker, 0))
+}
@@ -3,11 +3,23 @@ package tyrgin
 import (
 	"bufio"
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
 	"github.com/mongodb/mongo-go-driver/mongo"
 	"github.com/mongodb/mongo-go-driver/mongo/gridfs"
+	log "github.com/sirupsen/logrus"
 )
 
 // Creator Types/Structs
@@ -43,13 +55,108 @@ var (
 	ErrorMongoSessionFailure = errors.New("FAILED TO GET MONGO SESSION")
 	// MongoCollectionFailure an error to throw for when a mongo collection does not exist.
 	ErrorMongoCollectionFailure = errors.New("MONGO COLLECTION DOES NOT EXIST")
+	// ErrorRateLimitExceeded an error to throw when a client has made too many requests.
+	ErrorRateLimitExceeded = errors.New("RATE LIMIT EXCEEDED")
+	// ErrorRateLimitContention an error to throw when a shared rate limit could not be updated.
+	ErrorRateLimitContention = errors.New("RATE LIMIT CONTENTION")
+	// ErrorInvalidRateLimit an error to throw when a rate limit allows no requests or has no window.
+	ErrorInvalidRateLimit = errors.New("RATE LIMIT AND WINDOW MUST BE POSITIVE")
+	// ErrorIdempotencyConflict an error to throw when a request with the same Idempotency-Key is still running.
+	ErrorIdempotencyConflict = errors.New("REQUEST WITH IDEMPOTENCY KEY IN PROGRESS")
+	// ErrorIdempotencyKeyReused an error to throw when an Idempotency-Key is sent with a different request.
+	ErrorIdempotencyKeyReused = errors.New("IDEMPOTENCY KEY REUSED FOR A DIFFERENT REQUEST")
+	// ErrorPreconditionFailed an error to throw when an If-Match precondition does not hold.
+	ErrorPreconditionFailed = errors.New("PRECONDITION FAILED")
+	// ErrorRequestBodyTooLarge an error to throw when a request body is over the limit of its route.
+	ErrorRequestBodyTooLarge = errors.New("REQUEST BODY TOO LARGE")
+	// ErrorHandlerTimeout an error to throw when a handler runs past the deadline of its route.
+	ErrorHandlerTimeout = errors.New("HANDLER TIMED OUT")
+	// ErrorPanicRecovered an error to throw when a handler panicked.
+	ErrorPanicRecovered = errors.New("INTERNAL SERVER ERROR")
+	// ErrorPageNotFound an error to throw when nothing is found at a path.
+	ErrorPageNotFound = errors.New(NotFoundError)
+	// ErrorInvalidPagination an error to throw when the pagination query parameters are not valid.
+	ErrorInvalidPagination = errors.New("INVALID PAGINATION PARAMETERS")
+	// ErrorInvalidFilter an error to throw when a query filters on a field or with an operator or value that is not allowed.
+	ErrorInvalidFilter = errors.New("INVALID FILTER")
+	// ErrorInvalidSort an error to throw when a query sorts on a field that is not allowed.
+	ErrorInvalidSort = errors.New("INVALID SORT")
+	// ErrorResourceNotFound an error to throw when a document of a resource does not exist.
+	ErrorResourceNotFound = errors.New("RESOURCE NOT FOUND")
+	// ErrorForbidden an error to throw when a client may not use a route.
+	ErrorForbidden = errors.New("FORBIDDEN")
+	// ErrorFeatureFlagNotFound an error to throw when a feature flag does not exist.
+	ErrorFeatureFlagNotFound = errors.New("FEATURE FLAG NOT FOUND")
+	// ErrorInvalidFeatureFlag an error to throw when a feature flag has a rollout outside of 0 to 100.
+	ErrorInvalidFeatureFlag = errors.New("FEATURE FLAG ROLLOUT MUST BE BETWEEN 0 AND 100")
+	// ErrorInvalidFeatureFlagBody an error to throw when a feature flag can not be read from the request body.
+	ErrorInvalidFeatureFlagBody = errors.New("INVALID FEATURE FLAG")
+	// ErrorMaintenance an error to throw when a request can not be served because of maintenance.
+	ErrorMaintenance = errors.New("SERVICE UNDER MAINTENANCE")
+	// ErrorInvalidMaintenance an error to throw when a maintenance mode is not off, read-only or full.
+	ErrorInvalidMaintenance = errors.New("INVALID MAINTENANCE MODE")
+	// ErrorInvalidSchema an error to throw when a JSON Schema can not be compiled.
+	ErrorInvalidSchema = errors.New("INVALID JSON SCHEMA")
+	// ErrorRequestSchema an error to throw when a request body does not match its schema.
+	ErrorRequestSchema = errors.New("REQUEST BODY DOES NOT MATCH ITS SCHEMA")
+	// ErrorResponseSchema an error to throw when a response body does not match its schema.
+	ErrorResponseSchema = errors.New("RESPONSE BODY DOES NOT MATCH ITS SCHEMA")
+	// ErrorInvalidTenant an error to throw when a request has no tenant or one that is not allowed.
+	ErrorInvalidTenant = errors.New("INVALID TENANT")
+	// ErrorTenantDatabase an error to throw when the database of a tenant can not be reached.
+	ErrorTenantDatabase = errors.New("TENANT DATABASE UNAVAILABLE")
+	// ErrorTenantMismatch an error to throw when a request asks for another tenant than the one in its token.
+	ErrorTenantMismatch = errors.New("TENANT DOES NOT MATCH TOKEN")
+	// ErrorInvalidClientCA an error to throw when a client CA file holds no certificates.
+	ErrorInvalidClientCA = errors.New("NO CERTIFICATES IN CLIENT CA FILE")
+	// ErrorClientCertRequired an error to throw when a route needs a client certificate the client did not present.
+	ErrorClientCertRequired = errors.New("CLIENT CERTIFICATE REQUIRED")
+	// ErrorInvalidLogLevel an error to throw when a log level is not one logrus knows.
+	ErrorInvalidLogLevel = errors.New("INVALID LOG LEVEL")
+	// ErrorInvalidLogSink an error to throw when a log sink has no output or an unknown level or format.
+	ErrorInvalidLogSink = errors.New("INVALID LOG SINK")
+	// ErrorInvalidLogRotation an error to throw when a log rotation setting is not a valid size, duration or count.
+	ErrorInvalidLogRotation = errors.New("INVALID LOG ROTATION")
+	// ErrorInvalidLogBodyLimit an error to throw when the body capture limit is not a positive number of bytes.
+	ErrorInvalidLogBodyLimit = errors.New("INVALID LOG BODY LIMIT")
+	// ErrorInvalidVerboseLogging an error to throw when debug logging is raised for neither or both of a request ID and user, or for too long.
+	ErrorInvalidVerboseLogging = errors.New("INVALID VERBOSE LOGGING")
+	// ErrorCORSCredentialsForAnyOrigin an error to throw when CORS is configured to allow credentials from any origin.
+	ErrorCORSCredentialsForAnyOrigin = errors.New("CORS CAN NOT ALLOW CREDENTIALS FOR ANY ORIGIN")
+	// ErrorNotAcceptable an error to throw when a response can not be sent in any format the client accepts.
+	ErrorNotAcceptable = errors.New("NOT ACCEPTABLE")
 )
 
 // APIAction is the core of how you can easily add routes to the server.
+// Everything after Method is optional.
 type APIAction struct {
 	Func   func(gin *gin.Context)
 	Route  string
 	Method httpMethod
+	// RequireClientCert only serves clients that presented a client certificate.
+	RequireClientCert bool
+	// IgnoreMaintenance keeps the route working in maintenance.
+	IgnoreMaintenance bool
+	// Tenants resolves the tenant of the request after the JWT middleware.
+	Tenants *Tenants
+	// FeatureFlag hides the route behind a flag.
+	FeatureFlag *FeatureFlagGate
+	// RateLimit limits how often a client may call the route.
+	RateLimit *RateLimit
+	// MaxBodyBytes limits the size of the request body.
+	MaxBodyBytes int64
+	// Timeout is the deadline for the handler.
+	Timeout time.Duration
+	// IfMatch returns the ETag of the resource If-Match is checked against.
+	IfMatch ETagFunc
+	// RequestSchema is the JSON Schema the request body must match.
+	RequestSchema *JSONSchema
+	// ResponseSchema is the JSON Schema the response body must match.
+	ResponseSchema *JSONSchema
+	// Redaction is what Logger hides of the requests of the route.
+	Redaction *RedactionPolicy
+	// SkipBodyLogging keeps Logger from logging the bodies of the route.
+	SkipBodyLogging bool
 }
 
 // NewRoute takes a function that takes gin context, endpoint, whether the route should be login protected, and method type.
@@ -100,6 +207,7 @@ type (
 		StatsLinks   []string               `json:"statsLinks"`
 		Dependencies []Dependency           `json:"dependencies"`
 		CustomData   map[string]interface{} `json:"customData"`
+		Maintenance  MaintenanceMode        `json:"maintenance"`
 	}
 
 	// Dependency is the dependency struct to go inside the AboutResponse struct
@@ -189,17 +297,721 @@ type (
 	MongoRPLStatusChecker struct {
 		RPL *mongo.Database
 	}
+
+	// PanicStatusChecker reports how many panics Recovery has recovered from,
+	// warning once there are at least Threshold of them. A Threshold of 0
+	// never warns.
+	PanicStatusChecker struct {
+		Threshold uint64
+	}
 )
 
 // Logger Types/Structs
 
+type (
+	// LogConfig configures the sinks of the standard logger, Level caps the
+	// level of all of them. BodyLimit is how many bytes of each request and
+	// response body Logger keeps, 64KiB when zero.
+	LogConfig struct {
+		Level     string
+		Sinks     []LogSink
+		BodyLimit int64
+	}
+
+	// LogSink is somewhere logs are written to: the Writer, or else the
+	// Output, which is stdout, stderr or a file that is appended to and
+	// rotated as Rotation says. Level is the least severe level written,
+	// everything by default, and Format is json, the default, or text unless
+	// a Formatter is given.
+	LogSink struct {
+		Output    string
+		Writer    io.Writer
+		Level     string
+		Format    string
+		Formatter log.Formatter
+		Rotation  LogRotation
+	}
+
+	// LogRotation rotates a log file once it would grow past MaxSize bytes
+	// or every Interval, at whole multiples of it. Rotated files are gzipped when Compress is set and
+	// removed when there are more than MaxBackups of them or they are older
+	// than MaxAge. Zero values turn each of these off.
+	LogRotation struct {
+		MaxSize    int64
+		Interval   time.Duration
+		MaxBackups int
+		MaxAge     time.Duration
+		Compress   bool
+	}
+
+	// RotatingFile is a log file that rotates itself.
+	RotatingFile struct {
+		path      string
+		rotation  LogRotation
+		mu        sync.Mutex
+		file      *os.File
+		size      int64
+		opened    time.Time
+		retryAt   time.Time
+		cleanupMu sync.Mutex
+		cleanups  sync.WaitGroup
+	}
+
+	// sinkHook writes the entries of the standard logger to a sink.
+	sinkHook struct {
+		writer    *sinkWriter
+		level     log.Level
+		formatter log.Formatter
+	}
+
+	// sinkWriter serializes writes to the output of a sink.
+	sinkWriter struct {
+		mu  sync.Mutex
+		out io.Writer
+	}
+)
+
+// RedactionPolicy is what Logger hides: the values of the Headers, named
+// regardless of case, the JSON values and query parameters at Paths, dot
+// separated keys where * is any key or array element and ** any number of
+// them, and whatever the Values patterns match in the strings that are left.
+type RedactionPolicy struct {
+	Headers []string
+	Paths   []string
+	Values  []*regexp.Regexp
+}
+
 // bufferedWriter a writer to add on top of
 type bufferedWriter struct {
 	gin.ResponseWriter
-	out    *bufio.Writer
-	Buffer bytes.Buffer
+	out       *bufio.Writer
+	Buffer    bytes.Buffer
+	uncopied  bool
+	limit     int64
+	size      int64
+	truncated bool
+}
+
+// requestBodyCapture copies the request body as the handlers read it, so the
+// logger never reads a body the handlers did not want. At most limit bytes
+// are copied, size counts all of them.
+type requestBodyCapture struct {
+	io.ReadCloser
+	buffer    bytes.Buffer
+	uncopied  bool
+	limit     int64
+	size      int64
+	truncated bool
+}
+
+// responseCaptureWriter copies everything written to the response so it can be
+// inspected once the handler is done.
+type responseCaptureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// CORS Types/Structs
+
+// CORSConfig configures the CORS middleware. AllowOrigins may contain exact
+// origins, "*" for any origin, or wildcard origins such as "https://*.stevens.edu".
+// AllowOriginPatterns holds regular expressions matched against the whole origin.
+// AllowCredentials is ignored when any origin is allowed.
+type CORSConfig struct {
+	AllowOrigins        []string
+	AllowOriginPatterns []string
+	AllowMethods        []string
+	AllowHeaders        []string
+	ExposeHeaders       []string
+	AllowCredentials    bool
+	MaxAge              time.Duration
+}
+
+// corsPolicy is a CORSConfig compiled into the form the middleware uses.
+type corsPolicy struct {
+	allowAll         bool
+	origins          map[string]bool
+	patterns         []*regexp.Regexp
+	allowMethods     string
+	allowHeaders     string
+	exposeHeaders    string
+	allowCredentials bool
+	maxAge           string
 }
 
+// Rate Limit Types/Structs
+
+// RateLimitAlgorithm selects how a RateLimit counts requests.
+type RateLimitAlgorithm string
+
+// The supported rate limiting algorithms.
+const (
+	TokenBucket   RateLimitAlgorithm = "token-bucket"
+	SlidingWindow RateLimitAlgorithm = "sliding-window"
+)
+
+type (
+	// RateLimitKeyFunc returns the key a request is counted against, such as
+	// the client IP or the JWT identity.
+	RateLimitKeyFunc func(c *gin.Context) string
+
+	// RateLimit allows Limit requests per Window for each key. With TokenBucket
+	// Limit is also the burst size. Name separates the counters of different
+	// routes sharing a Store, it defaults to the method and path of the route.
+	RateLimit struct {
+		Name      string
+		Limit     int
+		Window    time.Duration
+		Algorithm RateLimitAlgorithm
+		KeyFunc   RateLimitKeyFunc
+		Store     RateLimitStore
+	}
+
+	// RateLimitResult is the outcome of counting a single request.
+	RateLimitResult struct {
+		Allowed    bool
+		Limit      int
+		Remaining  int
+		Reset      time.Duration
+		RetryAfter time.Duration
+	}
+
+	// RateLimitStore keeps the rate limiting state for every key.
+	RateLimitStore interface {
+		Take(key string, limit RateLimit) (RateLimitResult, error)
+	}
+
+	// MemoryRateLimitStore is a RateLimitStore for a single instance of a service.
+	MemoryRateLimitStore struct {
+		mu      sync.Mutex
+		buckets map[string]*rateLimitBucket
+		takes   int
+	}
+
+	// MongoRateLimitStore is a RateLimitStore shared by every replica of a service.
+	MongoRateLimitStore struct {
+		Collection *mongo.Collection
+	}
+
+	// rateLimitBucket is the state kept for one key by the MemoryRateLimitStore.
+	rateLimitBucket struct {
+		tokens      float64
+		last        time.Time
+		window      time.Duration
+		windowStart time.Time
+		previous    int
+		count       int
+	}
+
+	// rateLimitDocument is the state kept for one key by the MongoRateLimitStore.
+	rateLimitDocument struct {
+		ID       string    `bson:"_id"`
+		Tokens   float64   `bson:"tokens"`
+		Last     int64     `bson:"last"`
+		Count    int       `bson:"count"`
+		ExpireAt time.Time `bson:"expireAt"`
+	}
+)
+
+// Idempotency Types/Structs
+
+type (
+	// IdempotencyConfig configures the Idempotency middleware. TTL is how long a
+	// response is kept for replays, LockTimeout is how long a request may hold a
+	// key before another request may take it over, and Wait is how long a
+	// duplicate waits for the original request before getting a 409.
+	// MaxBodyBytes limits the bodies read to fingerprint requests, 1MiB by
+	// default.
+	IdempotencyConfig struct {
+		Store        IdempotencyStore
+		TTL          time.Duration
+		LockTimeout  time.Duration
+		Wait         time.Duration
+		MaxBodyBytes int64
+	}
+
+	// IdempotencyRecord is what is kept for each Idempotency-Key. Until
+	// Completed is set the request is still being handled. Owner tells the
+	// requests that held the key apart.
+	IdempotencyRecord struct {
+		Key         string              `bson:"_id"`
+		Fingerprint string              `bson:"fingerprint"`
+		Owner       string              `bson:"owner"`
+		Completed   bool                `bson:"completed"`
+		Status      int                 `bson:"status"`
+		Header      map[string][]string `bson:"header"`
+		Body        []byte              `bson:"body"`
+		LockedUntil time.Time           `bson:"lockedUntil"`
+		ExpireAt    time.Time           `bson:"expireAt"`
+	}
+
+	// IdempotencyStore keeps the IdempotencyRecords. Acquire stores record as in
+	// progress unless a live record for the key exists, in which case that record
+	// is returned instead. Release drops record unless another owner took the
+	// key over.
+	IdempotencyStore interface {
+		Acquire(record IdempotencyRecord) (existing *IdempotencyRecord, acquired bool, err error)
+		Complete(record IdempotencyRecord) error
+		Release(record IdempotencyRecord) error
+	}
+
+	// MemoryIdempotencyStore is an IdempotencyStore for a single instance of a service.
+	MemoryIdempotencyStore struct {
+		mu       sync.Mutex
+		records  map[string]IdempotencyRecord
+		acquires int
+	}
+
+	// MongoIdempotencyStore is an IdempotencyStore shared by every replica of a service.
+	MongoIdempotencyStore struct {
+		Collection *mongo.Collection
+	}
+)
+
+// Compression Types/Structs
+
+// CompressConfig configures the Compress middleware. Level is a compress/gzip
+// level where zero means gzip.DefaultCompression. Responses smaller than
+// MinSize bytes or whose Content-Type does not start with one of ContentTypes
+// are sent uncompressed.
+type CompressConfig struct {
+	Level        int
+	MinSize      int
+	ContentTypes []string
+}
+
+// compressWriter holds the response back until it knows whether it is worth
+// compressing, then writes it through compressor or as is.
+type compressWriter struct {
+	gin.ResponseWriter
+	config     CompressConfig
+	encoding   string
+	buffer     bytes.Buffer
+	compressor compressor
+	decided    bool
+}
+
+// compressor is what gzip and zlib writers have in common.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// ETag Types/Structs
+
+type (
+	// ETagConfig configures the ETag middleware. Weak makes the computed ETags
+	// weak validators.
+	ETagConfig struct {
+		Weak bool
+	}
+
+	// ETagFunc returns the current ETag of the resource a request targets, or
+	// an empty string when the resource does not exist.
+	ETagFunc func(c *gin.Context) (string, error)
+
+	// etagWriter holds the response back so its ETag can be computed before the
+	// headers are sent.
+	etagWriter struct {
+		gin.ResponseWriter
+		body        bytes.Buffer
+		passthrough bool
+	}
+)
+
+// Limit Types/Structs
+
+type (
+	// limitedBody fails reads once more than remaining bytes have been read.
+	limitedBody struct {
+		io.ReadCloser
+		remaining int64
+		exceeded  bool
+	}
+
+	// heldWriter keeps the response of a handler to itself until it
+	// finishes, so what it wrote can still be thrown away, as when it
+	// finished past its deadline or its response broke its schema.
+	heldWriter struct {
+		gin.ResponseWriter
+		header      http.Header
+		body        bytes.Buffer
+		wroteHeader bool
+	}
+)
+
+// SPA Types/Structs
+
+// SPAConfig configures how ServeSPA serves a single-page app. FileSystem is
+// where the app is served from, or Dir when it is nil, ./static by default.
+// Index is the page any unknown path falls back to, index.html by default.
+// Paths under ReservedPrefixes, /api and /status by default, never fall back
+// to it. Hashed assets are cached for AssetMaxAge, a year by default.
+type SPAConfig struct {
+	FileSystem       http.FileSystem
+	Dir              string
+	Index            string
+	ReservedPrefixes []string
+	AssetMaxAge      time.Duration
+}
+
+// Pagination Types/Structs
+
+type (
+	// PaginationConfig bounds the page sizes ParsePagination accepts. The
+	// DefaultLimit is 20 and the MaxLimit 100 unless set.
+	PaginationConfig struct {
+		DefaultLimit int64
+		MaxLimit     int64
+	}
+
+	// Pagination is the page a request asked for, either by Offset or by
+	// Cursor.
+	Pagination struct {
+		Limit  int64
+		Offset int64
+		Cursor string
+		after  primitive.ObjectID
+	}
+
+	// PageInfo describes the page in a PageResponse.
+	PageInfo struct {
+		Limit      int64  `json:"limit"`
+		Offset     int64  `json:"offset"`
+		Total      *int64 `json:"total,omitempty"`
+		NextCursor string `json:"nextCursor,omitempty"`
+	}
+
+	// PageResponse is the envelope WritePage sends a page of data in.
+	PageResponse struct {
+		Data interface{} `json:"data"`
+		Page PageInfo    `json:"page"`
+	}
+)
+
+// Query Types/Structs
+
+type (
+	// FilterOperator is an operator a query parameter can filter with.
+	FilterOperator string
+
+	// FilterType is the type query values of a field are coerced to.
+	FilterType string
+
+	// FilterField allows a field to be filtered on. Column is its name in
+	// Mongo when that differs from the query parameter. Operators limits the
+	// operators allowed, Sortable allows sorting on it.
+	FilterField struct {
+		Type      FilterType
+		Column    string
+		Operators []FilterOperator
+		Sortable  bool
+	}
+
+	// FilterSchema is the allowlist of fields of a resource that queries may
+	// filter and sort on, by query parameter name.
+	FilterSchema map[string]FilterField
+)
+
+// Resource Types/Structs
+
+// ResourceAction is one of the actions Resource generates.
+type ResourceAction string
+
+type (
+	// ResourceConfig configures the APIActions Resource generates. Actions
+	// chooses them, all by default. Schema is what the list may filter and
+	// sort on and Pagination bounds its pages, with CursorPagination making
+	// it return next cursors from the first page. Authorize is called before
+	// every action, with the id of the document if there is one, and a 403
+	// is sent when it fails. Validate is called with a created, replaced or
+	// patched document before it is stored, and a 400 is sent when it fails.
+	// Projection returns the projection used for the documents sent back.
+	// Store replaces the Mongo collection the documents are kept in, with an
+	// in-memory fake in tests for example.
+	ResourceConfig struct {
+		Actions          []ResourceAction
+		Schema           FilterSchema
+		Pagination       PaginationConfig
+		CursorPagination bool
+		Authorize        func(c *gin.Context, action ResourceAction, id string) error
+		Validate         func(c *gin.Context, doc interface{}) error
+		Projection       func(c *gin.Context) bson.D
+		Store            ResourceStore
+	}
+
+	// ResourceStore is where a resource keeps its documents. Get, Replace,
+	// Update and Delete return ErrorResourceNotFound when there is no
+	// document with the given id.
+	ResourceStore interface {
+		Find(filter, sort bson.D, skip, limit int64, projection bson.D) ([]bson.Raw, error)
+		Count(filter bson.D) (int64, error)
+		Get(id primitive.ObjectID, projection bson.D) (bson.Raw, error)
+		Insert(doc bson.D) error
+		Replace(id primitive.ObjectID, doc bson.D) error
+		Update(id primitive.ObjectID, set bson.D, unset []string) error
+		Delete(id primitive.ObjectID) error
+	}
+
+	// MongoResourceStore keeps the documents of a resource in a collection.
+	MongoResourceStore struct {
+		Collection *mongo.Collection
+	}
+
+	// resource holds what the handlers of a resource need.
+	resource struct {
+		db     *mongo.Database
+		name   string
+		model  reflect.Type
+		config ResourceConfig
+	}
+)
+
+// SSE Types/Structs
+
+type (
+	// SSEEvent is a Server-Sent Event. Data that is a struct, slice or map is
+	// sent as JSON. Retry, when set, tells the browser how long to wait before
+	// reconnecting.
+	SSEEvent struct {
+		ID    string
+		Event string
+		Data  interface{}
+		Retry time.Duration
+	}
+
+	// SSEFunc sends the events of a stream, see NewSSERoute.
+	SSEFunc func(c *gin.Context, lastEventID string, events chan<- SSEEvent)
+
+	// SSEConfig configures a route made by NewSSERoute. Heartbeat is how often
+	// a comment is sent while there are no events, 15 seconds by default.
+	// Retry is sent to the browser as its reconnection delay when set.
+	SSEConfig struct {
+		Heartbeat time.Duration
+		Retry     time.Duration
+	}
+
+	// SSEBroker fans events out to the clients streaming them, keeping the
+	// latest ones for clients that reconnect.
+	SSEBroker struct {
+		mu          sync.Mutex
+		sequence    uint64
+		replay      []SSEEvent
+		replaySize  int
+		subscribers map[chan SSEEvent]bool
+	}
+)
+
+// Feature Flag Types/Structs
+
+type (
+	// FeatureFlag is a flag as it is stored. See Evaluate for how Enabled,
+	// Users, Roles and Rollout, a percentage of users, decide who it is on for.
+	FeatureFlag struct {
+		Name        string    `json:"name" bson:"_id"`
+		Description string    `json:"description" bson:"description"`
+		Enabled     bool      `json:"enabled" bson:"enabled"`
+		Users       []string  `json:"users,omitempty" bson:"users,omitempty"`
+		Roles       []string  `json:"roles,omitempty" bson:"roles,omitempty"`
+		Rollout     *int      `json:"rollout,omitempty" bson:"rollout,omitempty"`
+		UpdatedAt   time.Time `json:"updatedAt" bson:"updatedAt"`
+	}
+
+	// FlagSubject is who a flag is evaluated for.
+	FlagSubject struct {
+		User  string
+		Roles []string
+	}
+
+	// FlagSubjectFunc returns who the request handled by c is made by.
+	FlagSubjectFunc func(c *gin.Context) FlagSubject
+
+	// FeatureFlagStore is where feature flags are kept.
+	FeatureFlagStore interface {
+		All() ([]FeatureFlag, error)
+		Save(flag FeatureFlag) error
+		Delete(name string) error
+	}
+
+	// MemoryFeatureFlagStore is a FeatureFlagStore for a single replica or tests.
+	MemoryFeatureFlagStore struct {
+		mu    sync.Mutex
+		flags map[string]FeatureFlag
+	}
+
+	// MongoFeatureFlagStore is a FeatureFlagStore shared by every replica of a service.
+	MongoFeatureFlagStore struct {
+		Collection *mongo.Collection
+	}
+
+	// FeatureFlagConfig configures FeatureFlags. Store is where the flags are
+	// kept, in memory by default. They are reloaded when older than Refresh,
+	// 30 seconds by default. Subject says who a request is made by, by
+	// default read from the gin-jwt claims. Admin decides who may use the
+	// admin routes, by default subjects with the admin role.
+	FeatureFlagConfig struct {
+		Store   FeatureFlagStore
+		Refresh time.Duration
+		Subject FlagSubjectFunc
+		Admin   func(c *gin.Context) bool
+	}
+
+	// FeatureFlags evaluates the feature flags of a service from a cache of
+	// its store.
+	FeatureFlags struct {
+		config     FeatureFlagConfig
+		mu         sync.RWMutex
+		flags      map[string]FeatureFlag
+		loaded     time.Time
+		refreshing int32
+	}
+
+	// FeatureFlagGate hides an APIAction behind the flag called Name.
+	FeatureFlagGate struct {
+		Flags *FeatureFlags
+		Name  string
+	}
+)
+
+// Maintenance Types/Structs
+
+// MaintenanceMode is how much of a service is under maintenance.
+type MaintenanceMode string
+
+type (
+	// MaintenanceState is the maintenance mode of a service, with a Message
+	// for clients and RetryAfter, in seconds, for when to try again. Since is
+	// when the mode was entered.
+	MaintenanceState struct {
+		Mode       MaintenanceMode `json:"mode" bson:"mode"`
+		Message    string          `json:"message,omitempty" bson:"message,omitempty"`
+		RetryAfter int             `json:"retryAfter,omitempty" bson:"retryAfter,omitempty"`
+		Since      time.Time       `json:"since" bson:"since"`
+	}
+
+	// MaintenanceStore shares the maintenance state between replicas.
+	MaintenanceStore interface {
+		Load() (MaintenanceState, error)
+		Save(state MaintenanceState) error
+	}
+
+	// MongoMaintenanceStore is a MaintenanceStore keeping the state in a collection.
+	MongoMaintenanceStore struct {
+		Collection *mongo.Collection
+	}
+)
+
+// Schema Types/Structs
+type (
+	// JSONSchema is a compiled JSON Schema document.
+	JSONSchema struct {
+		root     interface{}
+		patterns map[string]*regexp.Regexp
+	}
+
+	// SchemaViolation is a place, as a JSON pointer, where a document breaks
+	// its schema.
+	SchemaViolation struct {
+		Pointer string `json:"pointer"`
+		Message string `json:"message"`
+	}
+
+	// ProblemDetails is an error response as described by RFC 7807.
+	ProblemDetails struct {
+		Type       string            `json:"type"`
+		Title      string            `json:"title"`
+		Status     int               `json:"status"`
+		Detail     string            `json:"detail,omitempty"`
+		Instance   string            `json:"instance,omitempty"`
+		Violations []SchemaViolation `json:"violations,omitempty"`
+	}
+)
+
+// Tenant Types/Structs
+type (
+	// TenantConfig configures how Tenants finds the tenant of a request: the
+	// JWT Claim, which the Header and the first label of the host, when
+	// Subdomain is set, must agree with, or else the Header, the subdomain
+	// and Default, in that order. Only the Allowed tenants, and those Known
+	// says exist, are served. Database names the database of a tenant and
+	// Connect connects to it.
+	TenantConfig struct {
+		Header    string
+		Subdomain bool
+		Claim     string
+		Default   string
+		Allowed   []string
+		Known     func(tenant string) (bool, error)
+		Database  func(tenant string) string
+		Connect   func(name string) (*mongo.Database, error)
+	}
+
+	// Tenants resolves the tenants of requests and keeps the database of
+	// every tenant it connected to.
+	Tenants struct {
+		config     TenantConfig
+		allowed    map[string]bool
+		mu         sync.Mutex
+		databases  map[string]*mongo.Database
+		connecting map[string]*tenantConnection
+	}
+
+	// TenantStatusChecker checks the databases of the tenants.
+	TenantStatusChecker struct {
+		Tenants *Tenants
+	}
+)
+
+// TLS Types/Structs
+type (
+	// TLSConfig is where RunTLS finds the certificate and key, and the CAs
+	// client certificates are checked against. The files are checked for
+	// changes every PollInterval, 30 seconds by default.
+	TLSConfig struct {
+		CertFile     string
+		KeyFile      string
+		ClientCAFile string
+		PollInterval time.Duration
+	}
+
+	// CertReloader keeps the certificate and client CAs of a TLS server,
+	// loading them again when the files change.
+	CertReloader struct {
+		config    TLSConfig
+		mu        sync.RWMutex
+		cert      *tls.Certificate
+		clientCAs *x509.CertPool
+		loaded    []time.Time
+	}
+
+	// CertExpiryStatusChecker reports when the certificate of Reloader
+	// expires, warning once it is within Warning of expiring.
+	CertExpiryStatusChecker struct {
+		Reloader *CertReloader
+		Warning  time.Duration
+	}
+)
+
+// Diagnostics Types/Structs
+type (
+	// DiagnosticsConfig configures DiagnosticsRoutes. IdentityKey is the
+	// claim holding the user, jwt.IdentityKey by default. Admin decides who
+	// may use the routes, users with the admin role by default.
+	DiagnosticsConfig struct {
+		IdentityKey string
+		Admin       func(c *gin.Context) bool
+	}
+
+	// VerboseLogging raises logging to debug level for a RequestID or a User
+	// for Duration, until Until, in the sinks at debug or trace level.
+	VerboseLogging struct {
+		RequestID string    `json:"requestId,omitempty"`
+		User      string    `json:"user,omitempty"`
+		Duration  string    `json:"duration,omitempty"`
+		Until     time.Time `json:"until"`
+	}
+)
+
 // GridFS Types/Structs
 
 // Bucket struct contains the gridfs Bucket as well its its chunk size and name.
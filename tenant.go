@@ -0,0 +1,275 @@
+package tyrgin
+
+import (
+	ctx "context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo"
+)
+
+// Tenant header and the gin context keys the tenant and its database are
+// stored under.
+const (
+	TenantHeader = "X-Tenant"
+	TenantKey    = "Tenant"
+	TenantDBKey  = "TenantDB"
+)
+
+// validTenant limits tenants to names that are safe in a database name.
+var validTenant = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,47}$`)
+
+// NewTenants returns Tenants resolving tenants as described by config. The
+// header is X-Tenant and the database of a tenant is DB_NAME_<tenant> unless
+// configured otherwise.
+func NewTenants(config TenantConfig) *Tenants {
+	if config.Header == "" {
+		config.Header = TenantHeader
+	}
+	if config.Database == nil {
+		config.Database = func(tenant string) string {
+			return os.Getenv("DB_NAME") + "_" + tenant
+		}
+	}
+	if config.Connect == nil {
+		config.Connect = GetMongoDB
+	}
+
+	allowed := make(map[string]bool, len(config.Allowed))
+	for _, tenant := range config.Allowed {
+		allowed[strings.ToLower(tenant)] = true
+	}
+
+	return &Tenants{
+		config:     config,
+		allowed:    allowed,
+		databases:  make(map[string]*mongo.Database),
+		connecting: make(map[string]*tenantConnection),
+	}
+}
+
+// subdomainTenant returns the leftmost label of a host with at least three
+// labels, so tenant.example.com is tenant and example.com is nobody.
+func subdomainTenant(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+
+	labels := strings.Split(host, ".")
+	if len(labels) < 3 {
+		return ""
+	}
+
+	return labels[0]
+}
+
+// claimTenant returns the tenant in the configured claim of the JWT of the
+// request, or "" when there is none.
+func (t *Tenants) claimTenant(c *gin.Context) string {
+	if t.config.Claim == "" {
+		return ""
+	}
+
+	claim, _ := jwt.ExtractClaims(c)[t.config.Claim].(string)
+	return strings.ToLower(claim)
+}
+
+// resolve finds the tenant of a request. The claim wins when there is one,
+// a header or subdomain naming another tenant is refused with
+// ErrorTenantMismatch. Otherwise the header is tried, then the subdomain,
+// and then the default tenant.
+func (t *Tenants) resolve(c *gin.Context) (string, error) {
+	requested := c.GetHeader(t.config.Header)
+	if requested == "" && t.config.Subdomain {
+		requested = subdomainTenant(c.Request.Host)
+	}
+	requested = strings.ToLower(requested)
+
+	if claim := t.claimTenant(c); claim != "" {
+		if requested != "" && requested != claim {
+			return "", ErrorTenantMismatch
+		}
+		return claim, nil
+	}
+
+	if requested == "" {
+		requested = strings.ToLower(t.config.Default)
+	}
+
+	return requested, nil
+}
+
+// known reports whether tenant is one of the Allowed tenants or, failing
+// that, one Known says exists.
+func (t *Tenants) known(tenant string) (bool, error) {
+	if t.allowed[tenant] {
+		return true, nil
+	}
+	if t.config.Known != nil {
+		return t.config.Known(tenant)
+	}
+
+	return false, nil
+}
+
+// tenantConnection is a connection to the database of a tenant in progress,
+// shared by everyone asking for that tenant meanwhile.
+type tenantConnection struct {
+	once sync.Once
+	db   *mongo.Database
+	err  error
+}
+
+// Database returns the database of a tenant, connecting to it through
+// GetMongoDB the first time it is asked for. Connecting does not hold up the
+// other tenants, and a failed connection is tried again by the next request.
+func (t *Tenants) Database(tenant string) (*mongo.Database, error) {
+	t.mu.Lock()
+	if db, ok := t.databases[tenant]; ok {
+		t.mu.Unlock()
+		return db, nil
+	}
+	connection, ok := t.connecting[tenant]
+	if !ok {
+		connection = &tenantConnection{}
+		t.connecting[tenant] = connection
+	}
+	t.mu.Unlock()
+
+	connection.once.Do(func() {
+		connection.db, connection.err = t.config.Connect(t.config.Database(tenant))
+	})
+
+	t.mu.Lock()
+	if t.connecting[tenant] == connection {
+		delete(t.connecting, tenant)
+		if connection.err == nil {
+			t.databases[tenant] = connection.db
+		}
+	}
+	t.mu.Unlock()
+
+	return connection.db, connection.err
+}
+
+// databasesByTenant returns the databases connected to so far.
+func (t *Tenants) databasesByTenant() map[string]*mongo.Database {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	databases := make(map[string]*mongo.Database, len(t.databases))
+	for tenant, db := range t.databases {
+		databases[tenant] = db
+	}
+
+	return databases
+}
+
+// Resolve returns a middleware storing the tenant of the request and its
+// database in the gin context, where GetTenant and GetTenantDB read them. A
+// request without a valid and known tenant gets a 400, one asking for
+// another tenant than its claim a 403. Add it to the router for tenants from
+// the header or subdomain, tenants from a claim need it after the JWT
+// middleware as the Tenants of an APIAction. A request whose tenant was
+// already resolved is only checked against its claim.
+func (t *Tenants) Resolve() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if resolved := GetTenant(c); resolved != "" {
+			if claim := t.claimTenant(c); claim != "" && claim != resolved {
+				ContextErrorLogger(c, ErrorTenantMismatch, fmt.Sprintf("Tenant %q does not match claim %q.", resolved, claim))
+				resourceError(c, ErrorTenantMismatch, http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		tenant, err := t.resolve(c)
+		if err != nil {
+			ContextErrorLogger(c, err, "Requested tenant does not match the claim.")
+			resourceError(c, err, http.StatusForbidden)
+			return
+		}
+
+		// Unknown tenants are refused before connecting, so clients can not
+		// make the service create databases.
+		known := false
+		if validTenant.MatchString(tenant) {
+			if known, err = t.known(tenant); err != nil {
+				ContextErrorLogger(c, err, fmt.Sprintf("Could not look up tenant %s.", tenant))
+				resourceError(c, ErrorTenantDatabase, http.StatusServiceUnavailable)
+				return
+			}
+		}
+		if !known {
+			ContextErrorLogger(c, ErrorInvalidTenant, fmt.Sprintf("Could not resolve tenant %q.", tenant))
+			resourceError(c, ErrorInvalidTenant, http.StatusBadRequest)
+			return
+		}
+
+		db, err := t.Database(tenant)
+		if err != nil {
+			ContextErrorLogger(c, err, fmt.Sprintf("Could not connect to the database of tenant %s.", tenant))
+			resourceError(c, ErrorTenantDatabase, http.StatusServiceUnavailable)
+			return
+		}
+
+		c.Set(TenantKey, tenant)
+		c.Set(TenantDBKey, db)
+		c.Next()
+	}
+}
+
+// GetTenant returns the tenant of the request handled by c, or "" when
+// there is none.
+func GetTenant(c *gin.Context) string {
+	return c.GetString(TenantKey)
+}
+
+// GetTenantDB returns the database of the tenant of the request handled by
+// c, or nil when there is none.
+func GetTenantDB(c *gin.Context) *mongo.Database {
+	value, _ := c.Get(TenantDBKey)
+	db, _ := value.(*mongo.Database)
+	return db
+}
+
+// CheckStatus pings the database of every tenant connected to so far, naming
+// the tenants whose database does not answer in the details.
+func (t TenantStatusChecker) CheckStatus(name string) StatusList {
+	databases := t.Tenants.databasesByTenant()
+
+	failed := []string{}
+	for tenant, db := range databases {
+		if err := db.RunCommand(ctx.Background(), bson.D{{Key: "ping", Value: 1}}).Err(); err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", tenant, err))
+		}
+	}
+	sort.Strings(failed)
+
+	if len(failed) > 0 {
+		return StatusList{StatusList: []Status{{
+			Description: name,
+			Result:      CRITICAL,
+			Details:     fmt.Sprintf("%v check failed for tenants: %s", name, strings.Join(failed, ", ")),
+		}}}
+	}
+
+	return StatusList{StatusList: []Status{{
+		Description: name,
+		Result:      OK,
+		Details:     fmt.Sprintf("%d tenants", len(databases)),
+	}}}
+}
@@ -0,0 +1,190 @@
+package tyrgin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/stretchr/testify/assert"
+)
+
+func testTenantConnect(connects *int) func(name string) (*mongo.Database, error) {
+	client, _ := mongo.NewClient("mongodb://localhost:27017")
+	return func(name string) (*mongo.Database, error) {
+		*connects++
+		if name == "tyr_broken" {
+			return nil, errors.New("no reachable servers")
+		}
+		return client.Database(name), nil
+	}
+}
+
+func TestSubdomainTenant(t *testing.T) {
+	assert.Equal(t, "cs146", subdomainTenant("cs146.tyr.example.com"))
+	assert.Equal(t, "cs146", subdomainTenant("cs146.tyr.edu:8080"))
+	assert.Equal(t, "", subdomainTenant("tyr.edu"))
+	assert.Equal(t, "", subdomainTenant("127.0.0.1:8080"))
+	assert.Equal(t, "", subdomainTenant("localhost"))
+}
+
+func TestTenantResolve(t *testing.T) {
+	connects := 0
+	tenants := NewTenants(TenantConfig{
+		Subdomain: true,
+		Allowed:   []string{"CS146", "cs385", "broken"},
+		Database: func(tenant string) string {
+			return "tyr_" + tenant
+		},
+		Connect: testTenantConnect(&connects),
+	})
+
+	router := gin.New()
+	router.Use(RequestID(), Logger(), tenants.Resolve())
+	router.GET("/courses", func(c *gin.Context) {
+		c.String(http.StatusOK, GetTenant(c)+" "+GetTenantDB(c).Name())
+	})
+
+	request := func(host, tenant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/courses", nil)
+		req.Host = host
+		if tenant != "" {
+			req.Header.Set(TenantHeader, tenant)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("tyr.edu", "cs146")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "cs146 tyr_cs146", w.Body.String())
+
+	w = request("cs385.tyr.edu", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "cs385 tyr_cs385", w.Body.String())
+
+	w = request("cs385.tyr.edu", "CS146")
+	assert.Equal(t, "cs146 tyr_cs146", w.Body.String())
+	assert.Equal(t, 2, connects)
+
+	assert.Equal(t, http.StatusBadRequest, request("tyr.edu", "").Code)
+	assert.Equal(t, http.StatusBadRequest, request("tyr.edu", "ma123").Code)
+	assert.Equal(t, http.StatusBadRequest, request("tyr.edu", "../admin").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, request("tyr.edu", "broken").Code)
+
+	status := TenantStatusChecker{Tenants: NewTenants(TenantConfig{})}.CheckStatus("tenants")
+	assert.Equal(t, OK, status.StatusList[0].Result)
+}
+
+func TestTenantLogged(t *testing.T) {
+	connects := 0
+	tenants := NewTenants(TenantConfig{Allowed: []string{"cs146"}, Connect: testTenantConnect(&connects)})
+
+	router := gin.New()
+	router.Use(tenants.Resolve())
+	router.GET("/courses", func(c *gin.Context) {
+		assert.Equal(t, "cs146", requestFields(c)["tenant"])
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/courses", nil)
+	req.Header.Set(TenantHeader, "cs146")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestTenantClaimWins(t *testing.T) {
+	connects := 0
+	tenants := NewTenants(TenantConfig{
+		Claim:   "tenant",
+		Known:   func(tenant string) (bool, error) { return tenant != "ma123", nil },
+		Connect: testTenantConnect(&connects),
+	})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if tenant := c.GetHeader("X-Token-Tenant"); tenant != "" {
+			c.Set("JWT_PAYLOAD", jwt.MapClaims{"tenant": tenant})
+		}
+	}, tenants.Resolve())
+	router.GET("/courses", func(c *gin.Context) {
+		c.String(http.StatusOK, GetTenant(c))
+	})
+
+	request := func(claim, header string) *httptest.ResponseRecorder {
+		return performRequest(router, "GET", "/courses", nil, "X-Token-Tenant", claim, TenantHeader, header)
+	}
+
+	w := request("cs146", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "cs146", w.Body.String())
+	assert.Equal(t, http.StatusOK, request("cs146", "CS146").Code)
+	assert.Equal(t, http.StatusForbidden, request("cs146", "cs385").Code)
+
+	// Tenants that do not exist are never connected to.
+	assert.Equal(t, http.StatusBadRequest, request("", "ma123").Code)
+	assert.Equal(t, 1, connects)
+
+	// A tenant resolved earlier must still agree with the claim.
+	early := gin.New()
+	early.Use(func(c *gin.Context) {
+		c.Set(TenantKey, "cs385")
+		c.Set("JWT_PAYLOAD", jwt.MapClaims{"tenant": "cs146"})
+	}, tenants.Resolve())
+	early.GET("/courses", func(c *gin.Context) { c.Status(http.StatusOK) })
+	assert.Equal(t, http.StatusForbidden, performRequest(early, "GET", "/courses", nil).Code)
+}
+
+func TestTenantDatabaseConnectsOutsideLock(t *testing.T) {
+	client, _ := mongo.NewClient("mongodb://localhost:27017")
+	slow := make(chan struct{})
+	var mu sync.Mutex
+	connects := map[string]int{}
+	tenants := NewTenants(TenantConfig{
+		Database: func(tenant string) string {
+			return "tyr_" + tenant
+		},
+		Connect: func(name string) (*mongo.Database, error) {
+			mu.Lock()
+			connects[name]++
+			mu.Unlock()
+			if name == "tyr_cs146" {
+				<-slow
+			}
+			return client.Database(name), nil
+		},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db, err := tenants.Database("cs146")
+			assert.Nil(t, err)
+			assert.Equal(t, "tyr_cs146", db.Name())
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		tenants.Database("cs385")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("connecting to one tenant held up another")
+	}
+
+	close(slow)
+	wg.Wait()
+	assert.Equal(t, 1, connects["tyr_cs146"])
+}
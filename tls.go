@@ -0,0 +1,256 @@
+package tyrgin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewCertReloader loads the certificate, key and client CAs of config. They
+// are only loaded again by Reload, or by Watch once it runs.
+func NewCertReloader(config TLSConfig) (*CertReloader, error) {
+	if config.PollInterval <= 0 {
+		config.PollInterval = 30 * time.Second
+	}
+
+	r := &CertReloader{config: config}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// modTimes returns when the files of the reloader last changed.
+func (r *CertReloader) modTimes() []time.Time {
+	times := []time.Time{}
+	for _, file := range []string{r.config.CertFile, r.config.KeyFile, r.config.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+
+		var modTime time.Time
+		if info, err := os.Stat(file); err == nil {
+			modTime = info.ModTime()
+		}
+		times = append(times, modTime)
+	}
+
+	return times
+}
+
+// Reload loads the certificate, key and client CAs again. Connections that
+// are open keep the certificate they were made with, new ones get the new
+// one. If anything fails to load the old ones are kept.
+func (r *CertReloader) Reload() error {
+	modTimes := r.modTimes()
+
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		r.failed(modTimes)
+		return err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		r.failed(modTimes)
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if r.config.ClientCAFile != "" {
+		data, err := ioutil.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			r.failed(modTimes)
+			return err
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			r.failed(modTimes)
+			return ErrorInvalidClientCA
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.loaded = modTimes
+	r.mu.Unlock()
+
+	NormalLog(fmt.Sprintf("Loaded TLS certificate %s, it expires %s.", r.config.CertFile, cert.Leaf.NotAfter.Format(time.RFC3339)))
+
+	return nil
+}
+
+// failed remembers the files that failed to load, so they are not loaded
+// again until they change once more.
+func (r *CertReloader) failed(modTimes []time.Time) {
+	r.mu.Lock()
+	r.loaded = modTimes
+	r.mu.Unlock()
+}
+
+// changed reports whether any of the files changed since they were loaded.
+func (r *CertReloader) changed() bool {
+	modTimes := r.modTimes()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := range modTimes {
+		if i >= len(r.loaded) || !modTimes[i].Equal(r.loaded[i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Watch reloads the files when they change, checking every PollInterval,
+// and on SIGHUP. Call the returned function to stop.
+func (r *CertReloader) Watch() func() {
+	stop := make(chan struct{})
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		ticker := time.NewTicker(r.config.PollInterval)
+		defer ticker.Stop()
+		defer signal.Stop(hangup)
+
+		for {
+			select {
+			case <-ticker.C:
+				if !r.changed() {
+					continue
+				}
+			case <-hangup:
+			case <-stop:
+				return
+			}
+
+			ErrorLogger(r.Reload(), "Could not reload TLS certificate, keeping the old one.")
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+// Certificate returns the certificate currently served.
+func (r *CertReloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert
+}
+
+// TLSConfig returns a tls.Config serving the current certificate. When there
+// are client CAs, clients may present a certificate signed by one of them,
+// and RequireClientCert makes routes only serve clients that did.
+func (r *CertReloader) TLSConfig() *tls.Config {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.Certificate(), nil
+		},
+	}
+
+	if r.config.ClientCAFile != "" {
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			clientConfig := config.Clone()
+			clientConfig.GetConfigForClient = nil
+			clientConfig.ClientCAs = r.clientCAs
+			clientConfig.ClientAuth = tls.VerifyClientCertIfGiven
+
+			return clientConfig, nil
+		}
+	}
+
+	return config
+}
+
+// Serve serves handler over HTTPS on addr with the certificates of the
+// reloader, watching them for changes while it runs.
+func (r *CertReloader) Serve(addr string, handler http.Handler) error {
+	stop := r.Watch()
+	defer stop()
+
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: r.TLSConfig(),
+	}
+
+	return server.ListenAndServeTLS("", "")
+}
+
+// RunTLS serves the router over HTTPS on addr, reloading the certificate and
+// key when they change or on SIGHUP without dropping connections.
+func RunTLS(router *gin.Engine, addr string, config TLSConfig) error {
+	reloader, err := NewCertReloader(config)
+	if err != nil {
+		return err
+	}
+
+	return reloader.Serve(addr, router)
+}
+
+// RequireClientCert returns a middleware refusing requests with a 403 unless
+// the client presented a certificate signed by one of the client CAs.
+func RequireClientCert() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			ContextErrorLogger(c, ErrorClientCertRequired, "Request without a client certificate to an internal route.")
+			resourceError(c, ErrorClientCertRequired, http.StatusForbidden)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// CheckStatus reports when the served certificate expires, warning once it
+// is within Warning, 30 days by default, of expiring.
+func (e CertExpiryStatusChecker) CheckStatus(name string) StatusList {
+	warning := e.Warning
+	if warning <= 0 {
+		warning = 30 * 24 * time.Hour
+	}
+
+	notAfter := e.Reloader.Certificate().Leaf.NotAfter
+	left := time.Until(notAfter)
+
+	result := OK
+	details := fmt.Sprintf("Certificate expires %s", notAfter.Format(time.RFC3339))
+	switch {
+	case left <= 0:
+		result = CRITICAL
+		details = fmt.Sprintf("Certificate expired %s", notAfter.Format(time.RFC3339))
+	case left <= warning:
+		result = WARNING
+	}
+
+	return StatusList{
+		StatusList: []Status{
+			{
+				Description: name,
+				Result:      result,
+				Details:     details,
+			},
+		},
+	}
+}
@@ -0,0 +1,160 @@
+package tyrgin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCert writes a certificate signed by parent, or a self signed CA
+// when parent is nil, and its key to dir.
+func writeTestCert(t *testing.T, dir, name string, serial int64, notAfter time.Time, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	return cert, key
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyrgin-tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca, caKey := writeTestCert(t, dir, "ca", 1, time.Now().Add(24*time.Hour), nil, nil)
+	writeTestCert(t, dir, "server", 2, time.Now().Add(365*24*time.Hour), ca, caKey)
+	writeTestCert(t, dir, "client", 3, time.Now().Add(365*24*time.Hour), ca, caKey)
+
+	reloader, err := NewCertReloader(TLSConfig{
+		CertFile:     filepath.Join(dir, "server.pem"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	})
+	assert.Nil(t, err)
+
+	internal := NewRoute(func(c *gin.Context) {
+		c.String(http.StatusOK, "internal")
+	}, "internal", GET)
+	internal.RequireClientCert = true
+
+	router := gin.New()
+	AddRoutes(router, false, nil, "1", "test", []APIAction{internal})
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", reloader.TLSConfig())
+	assert.Nil(t, err)
+	server := &http.Server{Handler: router}
+	go server.Serve(listener)
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	get := func(clientCerts []tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: clientCerts},
+		}}
+		return client.Get("https://" + listener.Addr().String() + "/api/v1/test/internal")
+	}
+
+	resp, err := get(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, int64(2), resp.TLS.PeerCertificates[0].SerialNumber.Int64())
+	resp.Body.Close()
+
+	clientCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key"))
+	assert.Nil(t, err)
+	resp, err = get([]tls.Certificate{clientCert})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	// A broken certificate is not loaded, the old one is kept.
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "server.pem"), []byte("garbage"), 0600))
+	assert.NotNil(t, reloader.Reload())
+	assert.Equal(t, int64(2), reloader.Certificate().Leaf.SerialNumber.Int64())
+	assert.False(t, reloader.changed())
+
+	writeTestCert(t, dir, "server", 4, time.Now().Add(10*24*time.Hour), ca, caKey)
+	assert.Nil(t, reloader.Reload())
+
+	resp, err = get([]tls.Certificate{clientCert})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), resp.TLS.PeerCertificates[0].SerialNumber.Int64())
+	resp.Body.Close()
+
+	status := CertExpiryStatusChecker{Reloader: reloader}.CheckStatus("certificate")
+	assert.Equal(t, WARNING, status.StatusList[0].Result)
+	status = CertExpiryStatusChecker{Reloader: reloader, Warning: time.Hour}.CheckStatus("certificate")
+	assert.Equal(t, OK, status.StatusList[0].Result)
+}
+
+func TestCertReloaderWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyrgin-tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTestCert(t, dir, "server", 1, time.Now().Add(-time.Minute), nil, nil)
+	reloader, err := NewCertReloader(TLSConfig{
+		CertFile:     filepath.Join(dir, "server.pem"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		PollInterval: 10 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+
+	status := CertExpiryStatusChecker{Reloader: reloader}.CheckStatus("certificate")
+	assert.Equal(t, CRITICAL, status.StatusList[0].Result)
+
+	stop := reloader.Watch()
+	defer stop()
+
+	// Make sure the new files do not share the modification time of the old.
+	later := time.Now().Add(time.Minute)
+	writeTestCert(t, dir, "server", 2, time.Now().Add(time.Hour), nil, nil)
+	os.Chtimes(filepath.Join(dir, "server.pem"), later, later)
+
+	deadline := time.Now().Add(time.Second)
+	for reloader.Certificate().Leaf.SerialNumber.Int64() != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, int64(2), reloader.Certificate().Leaf.SerialNumber.Int64())
+}
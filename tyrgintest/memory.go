@@ -0,0 +1,538 @@
+package tyrgintest
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+	"github.com/stevens-tyr/tyr-gin"
+)
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Seed adds documents to the store, giving those without an _id one. The
+// ids of the documents are returned in order.
+func (m *MemoryStore) Seed(docs ...interface{}) ([]primitive.ObjectID, error) {
+	ids := []primitive.ObjectID{}
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		var fields bson.D
+		if err := bson.Unmarshal(raw, &fields); err != nil {
+			return nil, err
+		}
+
+		id, ok := bson.Raw(raw).Lookup("_id").ObjectIDOK()
+		if !ok || id.IsZero() {
+			id = primitive.NewObjectID()
+			withID := bson.D{{Key: "_id", Value: id}}
+			for _, field := range fields {
+				if field.Key != "_id" {
+					withID = append(withID, field)
+				}
+			}
+			fields = withID
+		}
+
+		if err := m.Insert(fields); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// Find returns the documents matching filter, sorted, skipped and limited.
+func (m *MemoryStore) Find(filter, sortBy bson.D, skip, limit int64, projection bson.D) ([]bson.Raw, error) {
+	if skip < 0 {
+		return nil, ErrorNegativeSkip
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := []bson.Raw{}
+	for _, doc := range m.docs {
+		ok, err := matches(doc, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			found = append(found, doc)
+		}
+	}
+
+	if len(sortBy) > 0 {
+		sort.SliceStable(found, func(i, j int) bool {
+			for _, field := range sortBy {
+				order := compare(value(found[i], field.Key), value(found[j], field.Key))
+				if direction, _ := toNumber(field.Value); direction < 0 {
+					order = -order
+				}
+				if order != 0 {
+					return order < 0
+				}
+			}
+			return false
+		})
+	}
+
+	if skip >= int64(len(found)) {
+		return []bson.Raw{}, nil
+	}
+	found = found[skip:]
+	if limit > 0 && limit < int64(len(found)) {
+		found = found[:limit]
+	}
+
+	projected := make([]bson.Raw, 0, len(found))
+	for _, doc := range found {
+		doc, err := project(doc, projection)
+		if err != nil {
+			return nil, err
+		}
+		projected = append(projected, doc)
+	}
+
+	return projected, nil
+}
+
+// Count returns the number of documents matching filter.
+func (m *MemoryStore) Count(filter bson.D) (int64, error) {
+	docs, err := m.Find(filter, nil, 0, 0, nil)
+	return int64(len(docs)), err
+}
+
+// Get returns the document with the given id.
+func (m *MemoryStore) Get(id primitive.ObjectID, projection bson.D) (bson.Raw, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(id)
+	if i < 0 {
+		return nil, tyrgin.ErrorResourceNotFound
+	}
+
+	return project(m.docs[i], projection)
+}
+
+// Insert stores a new document, refusing one with the _id of another.
+func (m *MemoryStore) Insert(doc bson.D) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Mongo refuses a second document with the same _id.
+	if id, err := bson.Raw(raw).LookupErr("_id"); err == nil {
+		for _, doc := range m.docs {
+			if existing, err := doc.LookupErr("_id"); err == nil && existing.Type == id.Type && bytes.Equal(existing.Value, id.Value) {
+				return ErrorDuplicateKey
+			}
+		}
+	}
+	m.docs = append(m.docs, raw)
+
+	return nil
+}
+
+// Replace stores doc in place of the document with the given id.
+func (m *MemoryStore) Replace(id primitive.ObjectID, doc bson.D) error {
+	raw, err := bson.Marshal(append(bson.D{{Key: "_id", Value: id}}, doc...))
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(id)
+	if i < 0 {
+		return tyrgin.ErrorResourceNotFound
+	}
+	m.docs[i] = raw
+
+	return nil
+}
+
+// Update sets and unsets top-level fields of the document with the given id.
+func (m *MemoryStore) Update(id primitive.ObjectID, set bson.D, unset []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(id)
+	if i < 0 {
+		return tyrgin.ErrorResourceNotFound
+	}
+
+	var fields bson.D
+	if err := bson.Unmarshal(m.docs[i], &fields); err != nil {
+		return err
+	}
+
+	updated := bson.D{}
+	for _, field := range fields {
+		removed := false
+		for _, key := range unset {
+			removed = removed || key == field.Key
+		}
+		if !removed {
+			updated = append(updated, field)
+		}
+	}
+	for _, field := range set {
+		replaced := false
+		for j := range updated {
+			if updated[j].Key == field.Key {
+				updated[j].Value = field.Value
+				replaced = true
+			}
+		}
+		if !replaced {
+			updated = append(updated, field)
+		}
+	}
+
+	raw, err := bson.Marshal(updated)
+	if err != nil {
+		return err
+	}
+	m.docs[i] = raw
+
+	return nil
+}
+
+// Delete removes the document with the given id.
+func (m *MemoryStore) Delete(id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(id)
+	if i < 0 {
+		return tyrgin.ErrorResourceNotFound
+	}
+	m.docs = append(m.docs[:i], m.docs[i+1:]...)
+
+	return nil
+}
+
+// index returns where the document with the given id is, -1 if nowhere.
+func (m *MemoryStore) index(id primitive.ObjectID) int {
+	for i, doc := range m.docs {
+		if docID, ok := doc.Lookup("_id").ObjectIDOK(); ok && docID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// value returns the field at a dotted key of doc as a plain Go value, numbers
+// as float64 and dates as time.Time. Missing fields are nil.
+func value(doc bson.Raw, key string) interface{} {
+	rv, err := doc.LookupErr(strings.Split(key, ".")...)
+	if err != nil {
+		return nil
+	}
+
+	return rawValue(rv)
+}
+
+// rawValue converts a bson value to a plain Go value.
+func rawValue(rv bson.RawValue) interface{} {
+	if f, ok := rv.DoubleOK(); ok {
+		return f
+	}
+	if i, ok := rv.Int32OK(); ok {
+		return float64(i)
+	}
+	if i, ok := rv.Int64OK(); ok {
+		return float64(i)
+	}
+	if s, ok := rv.StringValueOK(); ok {
+		return s
+	}
+	if b, ok := rv.BooleanOK(); ok {
+		return b
+	}
+	if t, ok := rv.TimeOK(); ok {
+		return t
+	}
+	if id, ok := rv.ObjectIDOK(); ok {
+		return id
+	}
+	if array, ok := rv.ArrayOK(); ok {
+		values, _ := array.Values()
+		elements := []interface{}{}
+		for _, element := range values {
+			elements = append(elements, rawValue(element))
+		}
+		return elements
+	}
+
+	return nil
+}
+
+// normalize converts a filter value to the plain Go values rawValue returns.
+func normalize(v interface{}) interface{} {
+	if f, ok := toNumber(v); ok {
+		return f
+	}
+
+	switch typed := v.(type) {
+	case primitive.DateTime:
+		return time.Unix(int64(typed)/1000, int64(typed)%1000*int64(time.Millisecond))
+	case time.Time:
+		return typed.Truncate(time.Millisecond)
+	}
+
+	return v
+}
+
+// toNumber converts the number types to float64.
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
+
+// compare orders two plain values of the same type, nil first. Values of
+// different types compare as equal.
+func compare(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	case bool:
+		if y, ok := b.(bool); ok && x != y {
+			if x {
+				return 1
+			}
+			return -1
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			switch {
+			case x.Before(y):
+				return -1
+			case x.After(y):
+				return 1
+			}
+		}
+	case primitive.ObjectID:
+		if y, ok := b.(primitive.ObjectID); ok {
+			return bytes.Compare(x[:], y[:])
+		}
+	}
+
+	return 0
+}
+
+// equal reports whether a stored value equals a filter value, matching any
+// element of an array like Mongo does.
+func equal(stored, v interface{}) bool {
+	if elements, ok := stored.([]interface{}); ok {
+		for _, element := range elements {
+			if equal(element, v) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if stored == nil || v == nil {
+		return stored == nil && v == nil
+	}
+
+	switch stored.(type) {
+	case time.Time, primitive.ObjectID:
+		return sameType(stored, v) && compare(stored, v) == 0
+	}
+
+	return stored == v
+}
+
+// sameType reports whether a and b have the same type.
+func sameType(a, b interface{}) bool {
+	switch a.(type) {
+	case time.Time:
+		_, ok := b.(time.Time)
+		return ok
+	case primitive.ObjectID:
+		_, ok := b.(primitive.ObjectID)
+		return ok
+	}
+
+	return false
+}
+
+// ordered reports whether a stored value compares to a filter value with
+// the given comparison operator.
+func ordered(stored, v interface{}, op string) bool {
+	if stored == nil || v == nil {
+		return false
+	}
+	if _, ok := stored.([]interface{}); ok {
+		return false
+	}
+
+	order := compare(stored, v)
+	if order == 0 && !equal(stored, v) {
+		return false
+	}
+
+	switch op {
+	case "$lt":
+		return order < 0
+	case "$lte":
+		return order <= 0
+	case "$gt":
+		return order > 0
+	default:
+		return order >= 0
+	}
+}
+
+// matches reports whether doc matches the filter.
+func matches(doc bson.Raw, filter bson.D) (bool, error) {
+	for _, field := range filter {
+		if strings.HasPrefix(field.Key, "$") {
+			return false, ErrorUnsupportedFilter
+		}
+		stored := value(doc, field.Key)
+
+		conditions, ok := field.Value.(bson.D)
+		if !ok {
+			if !equal(stored, normalize(field.Value)) {
+				return false, nil
+			}
+			continue
+		}
+
+		for _, condition := range conditions {
+			ok, err := satisfies(stored, condition)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// satisfies reports whether a stored value meets one operator condition.
+func satisfies(stored interface{}, condition bson.E) (bool, error) {
+	switch condition.Key {
+	case "$eq":
+		return equal(stored, normalize(condition.Value)), nil
+	case "$ne":
+		return !equal(stored, normalize(condition.Value)), nil
+	case "$lt", "$lte", "$gt", "$gte":
+		return ordered(stored, normalize(condition.Value), condition.Key), nil
+	case "$in", "$nin":
+		values, ok := condition.Value.(bson.A)
+		if !ok {
+			return false, ErrorUnsupportedFilter
+		}
+		in := false
+		for _, v := range values {
+			if equal(stored, normalize(v)) {
+				in = true
+				break
+			}
+		}
+		return in == (condition.Key == "$in"), nil
+	}
+
+	return false, ErrorUnsupportedFilter
+}
+
+// project applies an inclusion or exclusion projection to doc, keeping the
+// _id unless it is excluded.
+func project(doc bson.Raw, projection bson.D) (bson.Raw, error) {
+	if len(projection) == 0 {
+		return doc, nil
+	}
+
+	var fields bson.D
+	if err := bson.Unmarshal(doc, &fields); err != nil {
+		return nil, err
+	}
+
+	settings := map[string]bool{}
+	including := false
+	for _, field := range projection {
+		n, _ := toNumber(field.Value)
+		include := n != 0
+		if b, ok := field.Value.(bool); ok {
+			include = b
+		}
+		settings[field.Key] = include
+		if include && field.Key != "_id" {
+			including = true
+		}
+	}
+
+	projected := bson.D{}
+	for _, field := range fields {
+		include, set := settings[field.Key]
+		switch {
+		case field.Key == "_id":
+			if !set || include {
+				projected = append(projected, field)
+			}
+		case including && include:
+			projected = append(projected, field)
+		case !including && !set:
+			projected = append(projected, field)
+		}
+	}
+
+	raw, err := bson.Marshal(projected)
+	return raw, err
+}
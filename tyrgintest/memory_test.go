@@ -0,0 +1,128 @@
+package tyrgintest
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+	"github.com/stevens-tyr/tyr-gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type submission struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Status string             `json:"status" bson:"status"`
+	Grade  float64            `json:"grade" bson:"grade"`
+	Due    time.Time          `json:"due" bson:"due"`
+	Secret string             `json:"secret,omitempty" bson:"secret"`
+}
+
+var october = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+func setupSubmissions(t *testing.T) (*Server, *MemoryStore, []primitive.ObjectID) {
+	store := NewMemoryStore()
+	ids, err := store.Seed(
+		submission{Status: "graded", Grade: 90, Due: october.AddDate(0, 0, -7), Secret: "a"},
+		submission{Status: "submitted", Grade: 0, Due: october.AddDate(0, 0, 7), Secret: "b"},
+		submission{Status: "graded", Grade: 75, Due: october.AddDate(0, 0, -14), Secret: "c"},
+	)
+	assert.Nil(t, err)
+
+	config := tyrgin.ResourceConfig{
+		Store: store,
+		Schema: tyrgin.FilterSchema{
+			"status": {Type: tyrgin.FilterString},
+			"grade":  {Type: tyrgin.FilterFloat, Sortable: true},
+			"due":    {Type: tyrgin.FilterTime, Sortable: true},
+		},
+		Validate: func(c *gin.Context, doc interface{}) error {
+			if doc.(*submission).Grade > 100 {
+				return errors.New("GRADE TOO HIGH")
+			}
+			return nil
+		},
+		Projection: func(c *gin.Context) bson.D {
+			return bson.D{{Key: "secret", Value: 0}}
+		},
+	}
+
+	server := New(t).AddRoutes(false, "1", "submissions", tyrgin.Resource(nil, "submissions", submission{}, config))
+
+	return server, store, ids
+}
+
+func TestMemoryStoreResource(t *testing.T) {
+	server, store, ids := setupSubmissions(t)
+	defer server.Close()
+
+	server.GET("/api/v1/submissions?status=graded&due_lt=2026-10-01&sort=-grade").Do().
+		ExpectStatus(http.StatusOK).
+		ExpectHeader(tyrgin.TotalCountHeader, "2").
+		ExpectJSONField("data.0.grade", 90).
+		ExpectJSONField("data.1.grade", 75).
+		ExpectJSONField("page.total", 2)
+
+	var page struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	server.GET("/api/v1/submissions?grade_in=0,75").Do().DecodeJSON(&page)
+	assert.Equal(t, 2, len(page.Data))
+	assert.NotContains(t, page.Data[0], "secret")
+
+	server.GET("/api/v1/submissions/"+ids[1].Hex()).Do().
+		ExpectStatus(http.StatusOK).
+		ExpectJSONField("status", "submitted")
+
+	server.PATCH("/api/v1/submissions/" + ids[1].Hex()).WithJSON(gin.H{"grade": 101}).Do().
+		ExpectStatus(http.StatusBadRequest)
+	server.PATCH("/api/v1/submissions/"+ids[1].Hex()).WithJSON(gin.H{"status": "graded", "grade": 88}).Do().
+		ExpectStatus(http.StatusOK).
+		ExpectJSONField("grade", 88)
+
+	var created submission
+	server.POST("/api/v1/submissions").WithJSON(gin.H{"status": "submitted", "due": october}).Do().
+		ExpectStatus(http.StatusCreated).
+		DecodeJSON(&created)
+	count, _ := store.Count(bson.D{})
+	assert.Equal(t, int64(4), count)
+
+	server.DELETE("/api/v1/submissions/" + created.ID.Hex()).Do().ExpectStatus(http.StatusNoContent)
+	server.DELETE("/api/v1/submissions/" + created.ID.Hex()).Do().ExpectStatus(http.StatusNotFound)
+}
+
+func TestMemoryStoreDuplicateKey(t *testing.T) {
+	store := NewMemoryStore()
+	ids, err := store.Seed(submission{Grade: 1})
+	assert.Nil(t, err)
+
+	assert.Equal(t, ErrorDuplicateKey, store.Insert(bson.D{{Key: "_id", Value: ids[0]}, {Key: "grade", Value: 2}}))
+	count, _ := store.Count(bson.D{})
+	assert.Equal(t, int64(1), count)
+}
+
+func TestMemoryStoreCursor(t *testing.T) {
+	store := NewMemoryStore()
+	ids, _ := store.Seed(submission{Grade: 1}, submission{Grade: 2}, submission{Grade: 3})
+
+	p := tyrgin.Pagination{Limit: 2}
+	docs, err := store.Find(p.Filter(bson.D{}), bson.D{{Key: "_id", Value: 1}}, 0, p.Limit, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(docs))
+
+	next, _ := docs[1].Lookup("_id").ObjectIDOK()
+	assert.Equal(t, ids[1], next)
+
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: next}}}}
+	docs, _ = store.Find(filter, nil, 0, 2, nil)
+	assert.Equal(t, 1, len(docs))
+
+	_, err = store.Find(bson.D{{Key: "$where", Value: "1"}}, nil, 0, 0, nil)
+	assert.Equal(t, ErrorUnsupportedFilter, err)
+
+	_, err = store.Find(bson.D{}, nil, -1, 0, nil)
+	assert.Equal(t, ErrorNegativeSkip, err)
+}
@@ -0,0 +1,153 @@
+package tyrgintest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// WithHeader sets a header of the request.
+func (r *Request) WithHeader(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// WithBody sets the body of the request.
+func (r *Request) WithBody(body string) *Request {
+	r.body = []byte(body)
+	return r
+}
+
+// WithJSON sets the body of the request to body as JSON.
+func (r *Request) WithJSON(body interface{}) *Request {
+	r.server.t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		r.server.t.Fatal(err)
+	}
+	r.body = data
+	r.header.Set("Content-Type", "application/json; charset=utf-8")
+
+	return r
+}
+
+// WithClaims authorizes the request with a token carrying the claims.
+func (r *Request) WithClaims(claims map[string]interface{}) *Request {
+	r.claims = claims
+	r.hasAuth = true
+	return r
+}
+
+// Do sends the request to the Server.
+func (r *Request) Do() *Response {
+	r.server.t.Helper()
+
+	req, err := http.NewRequest(r.method, r.path, bytes.NewReader(r.body))
+	if err != nil {
+		r.server.t.Fatal(err)
+	}
+	req.Header = r.header
+	if r.hasAuth {
+		req.Header.Set("Authorization", r.server.JWT.TokenHeadName+" "+r.server.Token(r.claims))
+	}
+
+	resp := httptest.NewRecorder()
+	r.server.Router.ServeHTTP(resp, req)
+
+	return &Response{ResponseRecorder: resp, t: r.server.t}
+}
+
+// ExpectStatus asserts the status code of the response.
+func (r *Response) ExpectStatus(code int) *Response {
+	r.t.Helper()
+	assert.Equal(r.t, code, r.Code, "status code, body: %s", r.Body.String())
+	return r
+}
+
+// ExpectHeader asserts a header of the response.
+func (r *Response) ExpectHeader(key, value string) *Response {
+	r.t.Helper()
+	assert.Equal(r.t, value, r.Header().Get(key), "header %s", key)
+	return r
+}
+
+// ExpectJSON asserts the body of the response is the JSON of expected,
+// which may also be a JSON string.
+func (r *Response) ExpectJSON(expected interface{}) *Response {
+	r.t.Helper()
+
+	raw, ok := expected.(string)
+	if !ok {
+		data, err := json.Marshal(expected)
+		if err != nil {
+			r.t.Fatal(err)
+		}
+		raw = string(data)
+	}
+	assert.JSONEq(r.t, raw, r.Body.String())
+
+	return r
+}
+
+// ExpectJSONField asserts the value at a dotted path in the JSON body, such
+// as page.total or data.0.name.
+func (r *Response) ExpectJSONField(path string, expected interface{}) *Response {
+	r.t.Helper()
+
+	var body interface{}
+	if err := json.Unmarshal(r.Body.Bytes(), &body); err != nil {
+		r.t.Fatalf("response is not JSON: %v", err)
+	}
+
+	value, ok := lookup(body, path)
+	if !assert.True(r.t, ok, "no field %s in %s", path, r.Body.String()) {
+		return r
+	}
+
+	// Go through JSON so expected compares like the decoded body.
+	var normalized interface{}
+	data, _ := json.Marshal(expected)
+	json.Unmarshal(data, &normalized)
+	assert.Equal(r.t, normalized, value, "field %s", path)
+
+	return r
+}
+
+// DecodeJSON decodes the JSON body of the response into v.
+func (r *Response) DecodeJSON(v interface{}) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Body.Bytes(), v); err != nil {
+		r.t.Fatalf("response is not JSON: %v", err)
+	}
+	return r
+}
+
+// lookup finds the value at a dotted path in decoded JSON.
+func lookup(value interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			next, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			value = node[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return value, true
+}
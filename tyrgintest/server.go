@@ -0,0 +1,114 @@
+package tyrgintest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stevens-tyr/tyr-gin"
+)
+
+// Secret is the key the JWTs of a Server are signed with.
+const Secret = "tyrgintest-secret"
+
+// New returns a Server for t, with the request ID, logging and recovery
+// middleware of tyrgin.SetupRouter but without its status endpoints or
+// anything read from the environment. Close it once the test is done.
+func New(t *testing.T) *Server {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(tyrgin.RequestID())
+	router.Use(tyrgin.Logger())
+	router.Use(tyrgin.Recovery())
+
+	middleware, err := jwt.New(&jwt.GinJWTMiddleware{
+		Realm:   "tyrgintest",
+		Key:     []byte(Secret),
+		Timeout: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Server{
+		Router: router,
+		JWT:    middleware,
+		Logs:   test.NewGlobal(),
+		t:      t,
+	}
+}
+
+// Close removes the hook capturing the logs of the Server from the logger,
+// so the Servers of later tests do not see them.
+func (s *Server) Close() {
+	logger := log.StandardLogger()
+	hooks := make(log.LevelHooks)
+	for level, levelHooks := range logger.Hooks {
+		for _, hook := range levelHooks {
+			if hook != log.Hook(s.Logs) {
+				hooks[level] = append(hooks[level], hook)
+			}
+		}
+	}
+	logger.ReplaceHooks(hooks)
+}
+
+// AddRoutes adds the APIActions to the Server as tyrgin.AddRoutes does,
+// private routes requiring a token from Token.
+func (s *Server) AddRoutes(private bool, version, api string, fns []tyrgin.APIAction) *Server {
+	tyrgin.AddRoutes(s.Router, private, s.JWT, version, api, fns)
+	return s
+}
+
+// Token returns a JWT the Server accepts carrying the given claims.
+func (s *Server) Token(claims map[string]interface{}) string {
+	s.t.Helper()
+
+	middleware := *s.JWT
+	middleware.PayloadFunc = func(data interface{}) jwt.MapClaims {
+		claims, _ := data.(map[string]interface{})
+		return jwt.MapClaims(claims)
+	}
+
+	token, _, err := middleware.TokenGenerator(claims)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	return token
+}
+
+// Request starts a request to the Server.
+func (s *Server) Request(method, path string) *Request {
+	return &Request{server: s, method: method, path: path, header: http.Header{}}
+}
+
+// GET starts a GET request to the Server.
+func (s *Server) GET(path string) *Request {
+	return s.Request(http.MethodGet, path)
+}
+
+// POST starts a POST request to the Server.
+func (s *Server) POST(path string) *Request {
+	return s.Request(http.MethodPost, path)
+}
+
+// PUT starts a PUT request to the Server.
+func (s *Server) PUT(path string) *Request {
+	return s.Request(http.MethodPut, path)
+}
+
+// PATCH starts a PATCH request to the Server.
+func (s *Server) PATCH(path string) *Request {
+	return s.Request(http.MethodPatch, path)
+}
+
+// DELETE starts a DELETE request to the Server.
+func (s *Server) DELETE(path string) *Request {
+	return s.Request(http.MethodDelete, path)
+}
@@ -0,0 +1,74 @@
+package tyrgintest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/stevens-tyr/tyr-gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer(t *testing.T) {
+	hello := tyrgin.NewRoute(func(c *gin.Context) {
+		claims := jwt.ExtractClaims(c)
+		tyrgin.ContextNormalLog(c, "Said hello.")
+		c.JSON(http.StatusOK, gin.H{
+			"message": "hello " + claims["name"].(string),
+			"roles":   claims["roles"],
+		})
+	}, "hello", tyrgin.GET)
+
+	echo := tyrgin.NewRoute(func(c *gin.Context) {
+		var body map[string]interface{}
+		c.BindJSON(&body)
+		c.JSON(http.StatusCreated, body)
+	}, "echo", tyrgin.POST)
+
+	server := New(t).
+		AddRoutes(true, "1", "private", []tyrgin.APIAction{hello}).
+		AddRoutes(false, "1", "public", []tyrgin.APIAction{echo})
+	defer server.Close()
+
+	server.GET("/api/v1/private/hello").Do().ExpectStatus(http.StatusUnauthorized)
+
+	server.GET("/api/v1/private/hello").
+		WithClaims(map[string]interface{}{"name": "tyr", "roles": []string{"student"}}).
+		Do().
+		ExpectStatus(http.StatusOK).
+		ExpectJSON(gin.H{"message": "hello tyr", "roles": []string{"student"}}).
+		ExpectJSONField("roles.0", "student")
+
+	found := false
+	for _, entry := range server.Logs.AllEntries() {
+		if entry.Data["message"] == "Said hello." {
+			found = true
+		}
+	}
+	assert.True(t, found)
+
+	var body map[string]interface{}
+	server.POST("/api/v1/public/echo").
+		WithJSON(gin.H{"count": 2}).
+		WithHeader(tyrgin.RequestIDHeader, "test-request").
+		Do().
+		ExpectStatus(http.StatusCreated).
+		ExpectHeader(tyrgin.RequestIDHeader, "test-request").
+		ExpectJSON(`{"count": 2}`).
+		DecodeJSON(&body)
+	assert.Equal(t, 2.0, body["count"])
+}
+
+func TestServerClose(t *testing.T) {
+	server := New(t)
+	assert.NotEmpty(t, server.Token(nil))
+
+	server.Close()
+	for _, hooks := range log.StandardLogger().Hooks {
+		for _, hook := range hooks {
+			assert.NotEqual(t, log.Hook(server.Logs), hook)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package tyrgintest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// Errors
+var (
+	// ErrorUnsupportedFilter an error to throw when the MemoryStore is given a filter it does not understand.
+	ErrorUnsupportedFilter = errors.New("FILTER NOT SUPPORTED BY MEMORY STORE")
+	// ErrorNegativeSkip an error to throw when the MemoryStore is asked to skip a negative number of documents, as Mongo refuses to.
+	ErrorNegativeSkip = errors.New("SKIP MUST NOT BE NEGATIVE")
+	// ErrorDuplicateKey an error to throw when the MemoryStore is given a document with the _id of one it has, as Mongo refuses to.
+	ErrorDuplicateKey = errors.New("DUPLICATE KEY")
+)
+
+// Server Types/Structs
+
+// Server is a router set up for tests along with what is needed to call it:
+// a JWT middleware for private routes whose tokens can be minted with any
+// claims, and a hook capturing what is logged.
+type Server struct {
+	Router *gin.Engine
+	JWT    *jwt.GinJWTMiddleware
+	Logs   *test.Hook
+	t      *testing.T
+}
+
+// Request Types/Structs
+
+type (
+	// Request is a request being built to send to a Server.
+	Request struct {
+		server  *Server
+		method  string
+		path    string
+		header  http.Header
+		body    []byte
+		claims  map[string]interface{}
+		hasAuth bool
+	}
+
+	// Response is the response of a Server to a Request, with assertions on
+	// it that report to the test the Server was made for.
+	Response struct {
+		*httptest.ResponseRecorder
+		t *testing.T
+	}
+)
+
+// MemoryStore Types/Structs
+
+// MemoryStore is an in-memory stand in for the Mongo collection of a
+// tyrgin.Resource. It understands the filters tyrgin.ParseFilter and
+// tyrgin.Pagination produce, and top-level inclusion or exclusion
+// projections.
+type MemoryStore struct {
+	mu   sync.Mutex
+	docs []bson.Raw
+}